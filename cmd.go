@@ -0,0 +1,554 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"fgo-script-parser/fgoscript"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+)
+
+// cliOptions holds the flags shared by every subcommand
+type cliOptions struct {
+	includeWordCount bool
+	region           string
+	configPath       string
+	apiURL           string
+	staticURL        string
+	cacheDir         string
+	cacheTTL         time.Duration
+	noCache          bool
+	offline          bool
+	retries          int
+	retryDelay       time.Duration
+	concurrency      int
+	rateLimit        float64
+	sort             string
+	descending       bool
+	noSummary        bool
+	format           string
+	output           string
+	ifExists         string
+	template         string
+	history          string
+	record           bool
+	dialogue         bool
+	tsvSections      bool
+	keepDuplicates   bool
+	rules            string
+	names            string
+	collections      string
+
+	// Loaded before any command runs
+	config       Config
+	order        Sort
+	outputFormat OutputFormat
+}
+
+// loadConfig loads the config file and environment, then applies any flags that were set
+func (o *cliOptions) loadConfig(cmd *cobra.Command) error {
+	config, err := LoadConfig(o.configPath)
+	if err != nil {
+		return err
+	}
+
+	if cmd.Flags().Changed("api-url") {
+		config.APIURL = o.apiURL
+	}
+	if cmd.Flags().Changed("static-url") {
+		config.StaticURL = o.staticURL
+	}
+	if cmd.Flags().Changed("cache-dir") {
+		config.CacheDir = o.cacheDir
+	}
+	if cmd.Flags().Changed("cache-ttl") {
+		config.CacheTTL = Duration(o.cacheTTL)
+	}
+	if cmd.Flags().Changed("no-cache") {
+		config.NoCache = o.noCache
+	}
+	if cmd.Flags().Changed("offline") {
+		config.Offline = o.offline
+	}
+	if cmd.Flags().Changed("retries") {
+		config.Retries = o.retries
+	}
+	if cmd.Flags().Changed("retry-delay") {
+		config.RetryDelay = Duration(o.retryDelay)
+	}
+	if cmd.Flags().Changed("concurrency") {
+		config.Concurrency = o.concurrency
+	}
+	if cmd.Flags().Changed("rate-limit") {
+		config.RateLimit = o.rateLimit
+	}
+	if cmd.Flags().Changed("output") {
+		config.Output = o.output
+	}
+	if cmd.Flags().Changed("template") {
+		config.Template = o.template
+	}
+	if cmd.Flags().Changed("history") {
+		config.History = o.history
+	}
+	if cmd.Flags().Changed("record") {
+		config.Record = o.record
+	}
+	if cmd.Flags().Changed("dialogue") {
+		config.Dialogue = o.dialogue
+	}
+	if cmd.Flags().Changed("tsv-sections") {
+		config.TSVSections = o.tsvSections
+	}
+	if cmd.Flags().Changed("keep-duplicates") {
+		config.KeepDuplicates = o.keepDuplicates
+	}
+	if cmd.Flags().Changed("rules") {
+		config.Rules = o.rules
+	}
+	if cmd.Flags().Changed("names") {
+		config.Names = fgoscript.NameStyle(o.names)
+	}
+	if config.Names, err = fgoscript.ParseNameStyle(string(config.Names)); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("if-exists") {
+		config.IfExists = ExistsPolicy(o.ifExists)
+	}
+	if config.IfExists, err = ParseExistsPolicy(string(config.IfExists)); err != nil {
+		return err
+	}
+	if config.Output != "" {
+		if err := checkExistsPolicy(config.IfExists, o.outputFormat); err != nil {
+			return err
+		}
+	}
+	if cmd.Flags().Changed("collections") {
+		config.Collections = o.collections
+	}
+	if err := config.loadRules(); err != nil {
+		return err
+	}
+	if err := config.loadCollections(); err != nil {
+		return err
+	}
+	if config.Offline && (config.NoCache || config.CacheDir == "") {
+		return errors.New("offline mode needs the cache to be enabled")
+	}
+	o.config = config
+	return nil
+}
+
+// client returns the fgoscript client for the selected region
+func (o *cliOptions) client() (*fgoscript.Client, error) {
+	region, err := fgoscript.ParseRegion(o.region)
+	if err != nil {
+		return nil, err
+	}
+	return o.config.client(region), nil
+}
+
+// tuiOptions returns the starting options of the TUI, from the same flags and
+// config settings the subcommands use
+func (o *cliOptions) tuiOptions() (Options, error) {
+	region, err := fgoscript.ParseRegion(o.region)
+	if err != nil {
+		return Options{}, err
+	}
+	return Options{
+		format:           o.outputFormat,
+		ifExists:         o.config.IfExists,
+		includeWordCount: o.includeWordCount,
+		region:           region,
+		offline:          o.config.Offline,
+		sort:             o.order,
+		noSummary:        o.noSummary,
+		keepDuplicates:   o.config.KeepDuplicates,
+		names:            o.config.Names,
+		record:           o.config.Record,
+	}, nil
+}
+
+// showWordCount reports whether word counts should be written, which is
+// always the case for regions that count words
+func (o *cliOptions) showWordCount(client *fgoscript.Client) bool {
+	return o.includeWordCount || client.Region.CountMode() == fgoscript.CountWords
+}
+
+// writeResults writes the results in the selected order to the output file if
+// one is set, or to stdout otherwise
+func (o *cliOptions) writeResults(client *fgoscript.Client, results []fgoscript.ParseResult, metadata Metadata) error {
+	results = o.order.Apply(results)
+	opts := OutputOptions{
+		Format:           o.outputFormat,
+		IncludeWordCount: o.showWordCount(client),
+		NoSummary:        o.noSummary,
+		Metadata:         metadata,
+		Template:         o.config.Template,
+		Dialogue:         o.config.Dialogue,
+		TSVSections:      o.config.TSVSections,
+		Path:             o.config.Output,
+		IfExists:         o.config.IfExists,
+	}
+	if o.config.Output != "" {
+		path, err := writeResultsFile(results, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Results written to %s\n", path)
+	} else if err := WriteResults(os.Stdout, results, opts); err != nil {
+		return err
+	}
+	if duplicates := countDuplicates(results); duplicates > 0 {
+		fmt.Fprintf(os.Stderr, "%d duplicate scripts were left out of the counts\n", duplicates)
+	}
+	return nil
+}
+
+// finishRun writes the results of a run, then records it if recording is enabled.
+// The results are written first, so they aren't lost if the history database can't
+// be written to, which is only reported as a warning. It returns an error if any of
+// the results are incomplete
+func (o *cliOptions) finishRun(ctx context.Context, client *fgoscript.Client, results []fgoscript.ParseResult, metadata Metadata) error {
+	if err := o.writeResults(client, results, metadata); err != nil {
+		return err
+	}
+	if err := o.recordRun(ctx, metadata, results); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: the run was not recorded in history. %s\n", err)
+	}
+	return incompleteError(results)
+}
+
+// recordRun saves the run in the history database if recording is enabled
+func (o *cliOptions) recordRun(ctx context.Context, metadata Metadata, results []fgoscript.ParseResult) error {
+	if !o.config.Record {
+		return nil
+	}
+	id, err := recordRun(ctx, o.config.History, metadata, results)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Run recorded in history as %d\n", id)
+	return nil
+}
+
+func newRootCmd() *cobra.Command {
+	opts := &cliOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "fgo-script-parser",
+		Short: "Get the actual dialogue line and character count for FGO",
+		Long: "Get the actual dialogue line and character count for FGO.\n\n" +
+			"Running without a subcommand launches the interactive interface.\n" +
+			"Use the atlas or local subcommands to parse without it and print the results to stdout.",
+		Args:         cobra.NoArgs,
+		Version:      toolVersion(),
+		SilenceUsage: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			column, err := ParseSortColumn(opts.sort)
+			if err != nil {
+				return err
+			}
+			opts.order = Sort{Column: column, Descending: opts.descending}
+			opts.outputFormat, err = ParseOutputFormat(opts.format)
+			if err != nil {
+				return err
+			}
+			return opts.loadConfig(cmd)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			options, err := opts.tuiOptions()
+			if err != nil {
+				return err
+			}
+			p := tea.NewProgram(NewModel(opts.config, options), tea.WithAltScreen())
+			if _, err := p.Run(); err != nil {
+				return fmt.Errorf("could not run program: %s", err)
+			}
+			return nil
+		},
+	}
+
+	cmd.PersistentFlags().BoolVarP(&opts.includeWordCount, "words", "w", false, "include the approximate English word count")
+	cmd.PersistentFlags().StringVarP(&opts.region, "region", "r", string(fgoscript.RegionJP), "game region to fetch and count scripts for (JP, NA, CN, KR, TW)")
+	cmd.PersistentFlags().StringVar(&opts.configPath, "config", "", "path to the config file (default "+defaultConfigPath()+")")
+	cmd.PersistentFlags().StringVar(&opts.apiURL, "api-url", fgoscript.DefaultAPIURL, "base URL of the Atlas API (env "+apiURLEnv+")")
+	cmd.PersistentFlags().StringVar(&opts.staticURL, "static-url", fgoscript.DefaultStaticURL, "base URL of the static Atlas host for script files (env "+staticURLEnv+")")
+	cmd.PersistentFlags().StringVar(&opts.cacheDir, "cache-dir", fgoscript.DefaultCacheDir(), "directory for cached Atlas responses")
+	cmd.PersistentFlags().DurationVar(&opts.cacheTTL, "cache-ttl", 24*time.Hour, "how long cached responses are used before they are revalidated")
+	cmd.PersistentFlags().BoolVar(&opts.noCache, "no-cache", false, "don't read or write cached Atlas responses")
+	cmd.PersistentFlags().BoolVar(&opts.offline, "offline", false, "only use cached Atlas responses")
+	cmd.PersistentFlags().IntVar(&opts.retries, "retries", fgoscript.DefaultRetries, "number of retries for failed Atlas requests")
+	cmd.PersistentFlags().DurationVar(&opts.retryDelay, "retry-delay", fgoscript.DefaultRetryDelay, "delay before the first retry, doubling for each retry after that")
+	cmd.PersistentFlags().IntVar(&opts.concurrency, "concurrency", fgoscript.DefaultConcurrency, "maximum number of Atlas requests in flight at once, 0 for no limit")
+	cmd.PersistentFlags().Float64Var(&opts.rateLimit, "rate-limit", fgoscript.DefaultRateLimit, "maximum number of Atlas requests per second, 0 for no limit")
+	cmd.PersistentFlags().StringVar(&opts.sort, "sort", SortNone.String(), "column to sort the results by (none, id, name, lines, characters, words)")
+	cmd.PersistentFlags().BoolVar(&opts.descending, "desc", false, "sort the results in descending order")
+	cmd.PersistentFlags().StringVarP(&opts.format, "format", "f", FormatTSV.String(), "output format (tsv, json, ndjson, md, html)")
+	cmd.PersistentFlags().StringVar(&opts.template, "template", "", "template file for the md and html report formats, replacing the built-in one")
+	cmd.PersistentFlags().StringVarP(&opts.output, "output", "o", "", "write the results to a file instead of stdout. Supports {source}, {type}, {region}, {ids}, {date}, {time} and {ext}, e.g. out/{source}-{type}-{date}.{ext}")
+	cmd.PersistentFlags().StringVar(&opts.ifExists, "if-exists", string(Overwrite), "what to do if the output file exists (overwrite, append, unique)")
+	cmd.PersistentFlags().BoolVar(&opts.noSummary, "no-summary", false, "leave out the total, mean and median rows")
+	cmd.PersistentFlags().StringVar(&opts.history, "history", defaultHistoryPath(), "path of the SQLite database runs are recorded in")
+	cmd.PersistentFlags().BoolVar(&opts.record, "record", false, "record the run and its results in the history database")
+	cmd.PersistentFlags().BoolVar(&opts.dialogue, "dialogue", false, "write the dialogue text of every script to json and ndjson output, so it can be diffed")
+	cmd.PersistentFlags().BoolVar(&opts.tsvSections, "tsv-sections", false, "add the speaker, failed script and duplicate tables to tsv output after the results, separated by empty lines")
+	cmd.PersistentFlags().BoolVar(&opts.keepDuplicates, "keep-duplicates", false, "count scripts with the same contents as a script counted before them instead of leaving them out")
+	cmd.PersistentFlags().StringVar(&opts.rules, "rules", "", "rules file with special cases for Atlas wars and scripts, added to the built-in ones (default "+defaultRulesPath()+")")
+	cmd.PersistentFlags().StringVar(&opts.collections, "collections", "", "collections file with sets of wars to parse, added to the built-in ones (default "+defaultCollectionsPath()+")")
+	cmd.PersistentFlags().StringVar(&opts.names, "names", string(fgoscript.NamesEnglish), "names used for known wars and the local directories matched to them (en, jp, raw)")
+
+	cmd.AddCommand(newAtlasCmd(opts), newCollectionCmd(opts), newLocalCmd(opts), newCacheCmd(opts), newRulesCmd(opts), newHistoryCmd(opts), newDiffCmd(opts))
+	return cmd
+}
+
+func newAtlasCmd(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "atlas <war|quest|script> <id>...",
+		Short: "Parse scripts fetched from Atlas DB",
+		Example: "  fgo-script-parser atlas war 100 301\n" +
+			"  fgo-script-parser atlas quest 1000001\n" +
+			"  fgo-script-parser atlas script 0100000111",
+		ValidArgs: []string{"war", "quest", "script"},
+		Args:      cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			idType, err := fgoscript.ParseAtlasIdType(args[0])
+			if err != nil {
+				return err
+			}
+
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			metadata := newMetadata(client.Region, atlas, idType, args[1:])
+			results, err := client.ParseFromAtlas(cmd.Context(), args[1:], idType)
+			if err != nil {
+				return err
+			}
+			return opts.finishRun(cmd.Context(), client, results, metadata)
+		},
+	}
+}
+
+func newCollectionCmd(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "collection [name]",
+		Short: "Parse a predefined collection of wars from Atlas DB, or list the collections",
+		Long: "Parse a predefined collection of wars from Atlas DB, such as \"Lostbelts\" or \"All main story\".\n" +
+			"Results are given per member of the collection, and the total row is the total of the collection.\n" +
+			"Without a name, the collections are listed instead.",
+		Example: "  fgo-script-parser collection\n  fgo-script-parser collection \"Part 1 Singularities\"",
+		Args:    cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				w := csv.NewWriter(os.Stdout)
+				w.Comma = '\t'
+				w.Write([]string{"Name", "Size", "Description"})
+				for _, c := range opts.config.collections {
+					w.Write([]string{c.Name, c.summary(), c.Description})
+				}
+				w.Flush()
+				return w.Error()
+			}
+
+			collection, err := findCollection(opts.config.collections, args[0])
+			if err != nil {
+				return err
+			}
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			metadata, results, err := parseCollection(cmd.Context(), client, collection)
+			if err != nil {
+				return err
+			}
+			return opts.finishRun(cmd.Context(), client, results, metadata)
+		},
+	}
+}
+
+func newLocalCmd(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:     "local <path>...",
+		Short:   "Parse script files or directories stored locally",
+		Example: "  fgo-script-parser local ./scripts\n  fgo-script-parser local ./scripts/0100000111.txt",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+
+			metadata := newMetadata(client.Region, local, 0, args)
+			results, err := client.ParseFromLocal(cmd.Context(), args)
+			if err != nil {
+				return err
+			}
+			return opts.finishRun(cmd.Context(), client, results, metadata)
+		},
+	}
+}
+
+func newCacheCmd(opts *cliOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the cache of Atlas responses",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Remove every cached Atlas response",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cache := opts.config.cache()
+			if cache == nil {
+				return errors.New("the cache is disabled")
+			}
+			return cache.Clear()
+		},
+	})
+	return cmd
+}
+
+func newRulesCmd(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rules",
+		Short: "Print the special cases applied to Atlas wars and scripts, including the rules file",
+		Long: "Print the special cases applied to Atlas wars and scripts as JSON, with the rules file added to the built-in ones.\n" +
+			"The output can be used as a starting point for a rules file.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(opts.config.rules)
+		},
+	}
+}
+
+func newHistoryCmd(opts *cliOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List, show and delete runs recorded in the history database",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List every recorded run, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := OpenStore(opts.config.History)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			runs, err := store.Runs(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			w := csv.NewWriter(os.Stdout)
+			w.Comma = '\t'
+			w.Write([]string{"Run", "Date", "Source", "Region", "Type", "Inputs", "Results", "Lines", "Characters", "Complete"})
+			for _, run := range runs {
+				w.Write(historyRow(run))
+			}
+			w.Flush()
+			return w.Error()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:     "show <run>",
+		Short:   "Write the results of a recorded run, like the atlas and local commands do",
+		Example: "  fgo-script-parser history show 3 -f json",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid run %q", args[0])
+			}
+			store, err := OpenStore(opts.config.History)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			metadata, results, err := store.LoadRun(cmd.Context(), id)
+			if err != nil {
+				return err
+			}
+			if err := opts.writeResults(opts.config.client(metadata.Region), results, metadata); err != nil {
+				return err
+			}
+			return incompleteError(results)
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "delete <run>...",
+		Short: "Remove recorded runs and their results",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := OpenStore(opts.config.History)
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+			for _, arg := range args {
+				id, err := strconv.ParseInt(arg, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid run %q", arg)
+				}
+				if err := store.DeleteRun(cmd.Context(), id); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	return cmd
+}
+
+func newDiffCmd(opts *cliOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff <old> <new>",
+		Short: "Compare two sets of results, e.g. before and after a game update",
+		Long: "Compare two sets of results and list the items that were added, removed or changed, with their line and character deltas.\n\n" +
+			"Each set can be a run in the history (its ID or run:<ID>), a json or ndjson output file, or local script files or directories to parse.\n" +
+			"Changed scripts also list the dialogue lines added or removed, if both sets have their dialogue: recorded runs always do,\n" +
+			"output files need to be written with --dialogue.",
+		Example: "  fgo-script-parser diff 3 7\n" +
+			"  fgo-script-parser diff old.json new.json -f json\n" +
+			"  fgo-script-parser diff ./scripts-v1/0100000111.txt ./scripts-v2/0100000111.txt",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := opts.client()
+			if err != nil {
+				return err
+			}
+			oldMetadata, oldResults, err := loadResultSet(cmd.Context(), client, opts.config.History, args[0])
+			if err != nil {
+				return err
+			}
+			newMetadata, newResults, err := loadResultSet(cmd.Context(), client, opts.config.History, args[1])
+			if err != nil {
+				return err
+			}
+			matchSingleFiles(oldResults, newResults)
+
+			diff := newDiff(oldMetadata, newMetadata, oldResults, newResults)
+			return writeDiff(os.Stdout, diff, opts.outputFormat, opts.showWordCount(client))
+		},
+	}
+}
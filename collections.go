@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fgo-script-parser/fgoscript"
+)
+
+//go:embed collections.json
+var defaultCollectionsData []byte
+
+// Collection is a predefined set of wars that can be parsed instead of entering war IDs
+type Collection struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Wars, and arcs from the war table, that are each counted as a member of their own
+	Wars []string `json:"wars,omitempty"`
+	Arcs []string `json:"arcs,omitempty"`
+	// Members counted as a group of wars, after the wars and arcs above
+	Members []CollectionMember `json:"members,omitempty"`
+	// Adds a member for every year that has events, with the wars of the events that
+	// started in that year, found through Atlas. Added after the members above
+	EventYears bool `json:"eventYears,omitempty"`
+}
+
+// CollectionMember is a named group of wars in a collection, counted as a single result
+type CollectionMember struct {
+	Name string   `json:"name"`
+	Wars []string `json:"wars,omitempty"`
+	Arcs []string `json:"arcs,omitempty"`
+	// Adds the wars of every event that started in this year, found through Atlas
+	EventYear int `json:"eventYear,omitempty"`
+}
+
+// expandedMember is a member of a collection with its war IDs. Members without
+// a name are a single war, counted as is instead of as a group
+type expandedMember struct {
+	name string
+	wars []string
+}
+
+// defaultCollectionsPath returns the path of the collections file in the user config directory
+func defaultCollectionsPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fgo-script-parser", "collections.json")
+}
+
+// loadCollections adds the collections file to the built-in collections. A collection
+// in the file replaces the built-in collection with the same name. If no collections
+// file is set, the default collections file is used if it exists.
+func (c *Config) loadCollections() error {
+	if err := json.Unmarshal(defaultCollectionsData, &c.collections); err != nil {
+		return fmt.Errorf("could not parse built-in collections. %s", err)
+	}
+	path := c.Collections
+	explicit := path != ""
+	if !explicit {
+		path = defaultCollectionsPath()
+	}
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && (explicit || !errors.Is(err, fs.ErrNotExist)) {
+		return fmt.Errorf("could not read collections file %s. %s", path, err)
+	} else if err != nil {
+		return nil
+	}
+	var collections []Collection
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return fmt.Errorf("could not parse collections file %s. %s", path, err)
+	}
+	for _, collection := range collections {
+		i := slices.IndexFunc(c.collections, func(existing Collection) bool {
+			return strings.EqualFold(existing.Name, collection.Name)
+		})
+		if i >= 0 {
+			c.collections[i] = collection
+		} else {
+			c.collections = append(c.collections, collection)
+		}
+	}
+	return nil
+}
+
+// findCollection returns the collection with the given name, ignoring case
+func findCollection(collections []Collection, name string) (Collection, error) {
+	for _, c := range collections {
+		if strings.EqualFold(c.Name, name) {
+			return c, nil
+		}
+	}
+	return Collection{}, fmt.Errorf("there is no collection named %q. Run the collection command without a name to list them", name)
+}
+
+// arcWars returns the IDs of every war in the given arcs of the war table, in story order
+func arcWars(arcs []string) []string {
+	var ids []string
+	for _, w := range fgoscript.Wars() {
+		if slices.ContainsFunc(arcs, func(arc string) bool { return strings.EqualFold(arc, w.Arc) }) {
+			ids = append(ids, w.Id)
+		}
+	}
+	return ids
+}
+
+// knownWars returns the number of wars in the collection that are known without
+// asking Atlas, and whether it has members with wars found through Atlas
+func (c Collection) knownWars() (int, bool) {
+	wars := len(c.Wars) + len(arcWars(c.Arcs))
+	fromAtlas := c.EventYears
+	for _, m := range c.Members {
+		wars += len(m.Wars) + len(arcWars(m.Arcs))
+		fromAtlas = fromAtlas || m.EventYear != 0
+	}
+	return wars, fromAtlas
+}
+
+// summary describes the size of the collection, e.g. "9 wars" or "12 members, wars found through Atlas"
+func (c Collection) summary() string {
+	wars, fromAtlas := c.knownWars()
+	var parts []string
+	if c.EventYears {
+		parts = append(parts, "a member per year")
+	} else if len(c.Members) > 0 {
+		parts = append(parts, fmt.Sprintf("%d members", len(c.Members)+len(c.Wars)+len(arcWars(c.Arcs))))
+	}
+	if wars > 0 {
+		parts = append(parts, fmt.Sprintf("%d wars", wars))
+	}
+	if fromAtlas {
+		parts = append(parts, "wars found through Atlas")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// expand returns the members of the collection with their war IDs. Members without any wars are left out
+func (c Collection) expand(ctx context.Context, client *fgoscript.Client) ([]expandedMember, error) {
+	var members []expandedMember
+	for _, id := range append(slices.Clone(c.Wars), arcWars(c.Arcs)...) {
+		members = append(members, expandedMember{wars: []string{id}})
+	}
+	// Fetched once for every member with an event year
+	var eventWars map[int][]string
+	if c.EventYears || slices.ContainsFunc(c.Members, func(m CollectionMember) bool { return m.EventYear != 0 }) {
+		var err error
+		if eventWars, err = client.FetchEventWars(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range c.Members {
+		wars := append(slices.Clone(m.Wars), arcWars(m.Arcs)...)
+		if m.EventYear != 0 {
+			wars = append(wars, eventWars[m.EventYear]...)
+		}
+		if len(wars) > 0 {
+			members = append(members, expandedMember{name: m.Name, wars: wars})
+		}
+	}
+	if c.EventYears {
+		for _, year := range slices.Sorted(maps.Keys(eventWars)) {
+			members = append(members, expandedMember{name: strconv.Itoa(year), wars: eventWars[year]})
+		}
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("collection %s doesn't have any wars", c.Name)
+	}
+	return members, nil
+}
+
+// parseCollection counts every war in a collection, returning one result per member.
+// Members that are a group of wars are counted as a group result with the wars as its children
+func parseCollection(ctx context.Context, client *fgoscript.Client, collection Collection) (Metadata, []fgoscript.ParseResult, error) {
+	metadata := newMetadata(client.Region, atlas, fgoscript.IdTypeWar, nil)
+	metadata.Collection = collection.Name
+	members, err := collection.expand(ctx, client)
+	if err != nil {
+		return metadata, nil, err
+	}
+
+	for _, m := range members {
+		metadata.Inputs = append(metadata.Inputs, m.wars...)
+	}
+	results, err := client.ParseFromAtlas(ctx, metadata.Inputs, fgoscript.IdTypeWar)
+	if err != nil {
+		// Partial results can't be matched to their members
+		return metadata, results, err
+	}
+
+	var grouped []fgoscript.ParseResult
+	for _, m := range members {
+		wars := results[:len(m.wars)]
+		results = results[len(m.wars):]
+		if m.name == "" {
+			grouped = append(grouped, wars...)
+		} else {
+			grouped = append(grouped, fgoscript.GroupResults(m.name, wars))
+		}
+	}
+	return metadata, grouped, nil
+}
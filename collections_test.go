@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"fgo-script-parser/fgoscript"
+)
+
+// eventServer serves the Atlas war and event exports, and a war with a single script for every war ID
+func eventServer(t *testing.T) *fgoscript.Client {
+	jst := time.FixedZone("JST", 9*60*60)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/export/JP/basic_war.json":
+			fmt.Fprint(w, `[{"id": 100, "eventId": 0}, {"id": 9003, "eventId": 80003}, {"id": 9001, "eventId": 80001}, {"id": 9002, "eventId": 80002}]`)
+		case r.URL.Path == "/export/JP/basic_event.json":
+			fmt.Fprintf(w, `[{"id": 80001, "startedAt": %d}, {"id": 80002, "startedAt": %d}, {"id": 80003, "startedAt": %d}]`,
+				time.Date(2023, 8, 1, 18, 0, 0, 0, jst).Unix(),
+				// New year in Japan, but still 2023 in UTC
+				time.Date(2024, 1, 1, 1, 0, 0, 0, jst).Unix(),
+				time.Date(2024, 3, 1, 18, 0, 0, 0, jst).Unix())
+		case strings.HasPrefix(r.URL.Path, "/nice/JP/war/"):
+			id := strings.TrimPrefix(r.URL.Path, "/nice/JP/war/")
+			fmt.Fprintf(w, `{"name": "War %s", "spots": [{"quests": [{"id": 1, "name": "Quest", "type": "main", "phaseScripts": [{"phase": 1, "scripts": [{"scriptId": "%s0", "script": "%s/JP/Script/00/%s0.txt"}]}]}]}]}`,
+				id, id, fgoscript.DefaultStaticURL, id)
+		case strings.HasPrefix(r.URL.Path, "/JP/Script/"):
+			// Every war has its own line, so none of them are duplicates
+			fmt.Fprintf(w, "＠A：マシュ\n%s\n[k]\n", r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	client := fgoscript.NewClient(fgoscript.RegionJP)
+	client.APIURL, client.StaticURL, client.RateLimit = server.URL, server.URL, 0
+	return client
+}
+
+func TestBuiltInCollections(t *testing.T) {
+	var config Config
+	config.Collections = filepath.Join(t.TempDir(), "missing.json")
+	if err := config.loadCollections(); err == nil {
+		t.Error("got no error for a missing collections file that was set")
+	}
+
+	lostbelts, err := findCollection(config.collections, "lostbelts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"301", "302", "303", "304", "305", "306", "308", "310"}; !slices.Equal(lostbelts.Wars, want) {
+		t.Errorf("got Lostbelt wars %v, want %v", lostbelts.Wars, want)
+	}
+	for _, id := range lostbelts.Wars {
+		if war, found := fgoscript.FindWar(id); !found || !strings.HasPrefix(war.En, "Lostbelt No.") {
+			t.Errorf("war %s is %q, want a Lostbelt", id, war.En)
+		}
+	}
+	if _, err := findCollection(config.collections, "Part 3"); err == nil {
+		t.Error("got no error for an unknown collection")
+	}
+}
+
+func TestLoadCollections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collections.json")
+	err := os.WriteFile(path, []byte(`[
+		{"name": "lostbelts", "wars": ["301"]},
+		{"name": "Fuyuki and Orleans", "wars": ["100", "101"]}
+	]`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Collections: path}
+	if err := config.loadCollections(); err != nil {
+		t.Fatal(err)
+	}
+	// The collection with the same name is replaced where it was, and the new one added at the end
+	var names []string
+	for _, c := range config.collections {
+		names = append(names, c.Name)
+	}
+	if i := slices.Index(names, "lostbelts"); i != 2 || config.collections[i].Wars[0] != "301" || len(config.collections[i].Wars) != 1 {
+		t.Errorf("got collections %v, want Lostbelts replaced in place", names)
+	}
+	if names[len(names)-1] != "Fuyuki and Orleans" {
+		t.Errorf("got collections %v, want the new collection last", names)
+	}
+}
+
+func TestExpandCollection(t *testing.T) {
+	client := eventServer(t)
+	tests := []struct {
+		name       string
+		collection Collection
+		want       []expandedMember
+		summary    string
+	}{
+		{
+			"wars and arcs",
+			Collection{Wars: []string{"9999"}, Arcs: []string{"part 1.5"}},
+			[]expandedMember{{wars: []string{"9999"}}, {wars: []string{"201"}}, {wars: []string{"202"}}, {wars: []string{"203"}}, {wars: []string{"204"}}},
+			"5 wars",
+		},
+		{
+			"members",
+			Collection{Members: []CollectionMember{
+				{Name: "Epic of Remnant", Arcs: []string{"Part 1.5"}},
+				{Name: "Events 2023", EventYear: 2023},
+				{Name: "Empty", EventYear: 2019},
+			}},
+			[]expandedMember{{"Epic of Remnant", []string{"201", "202", "203", "204"}}, {"Events 2023", []string{"9001"}}},
+			"3 members, 4 wars, wars found through Atlas",
+		},
+		{
+			"event years",
+			Collection{EventYears: true},
+			[]expandedMember{{"2023", []string{"9001"}}, {"2024", []string{"9002", "9003"}}},
+			"a member per year, wars found through Atlas",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			members, err := tt.collection.expand(context.Background(), client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(members, tt.want, func(a, b expandedMember) bool {
+				return a.name == b.name && slices.Equal(a.wars, b.wars)
+			}) {
+				t.Errorf("got members %v, want %v", members, tt.want)
+			}
+			if summary := tt.collection.summary(); summary != tt.summary {
+				t.Errorf("got summary %q, want %q", summary, tt.summary)
+			}
+		})
+	}
+
+	if _, err := (Collection{Name: "Empty", Arcs: []string{"Part 9"}}).expand(context.Background(), client); err == nil {
+		t.Error("got no error for a collection without any wars")
+	}
+}
+
+func TestParseCollection(t *testing.T) {
+	collection := Collection{
+		Name:    "Test",
+		Wars:    []string{"9001"},
+		Members: []CollectionMember{{Name: "Group", Wars: []string{"9002", "9003"}}},
+	}
+	metadata, results, err := parseCollection(context.Background(), eventServer(t), collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Collection != "Test" || !slices.Equal(metadata.Inputs, []string{"9001", "9002", "9003"}) {
+		t.Errorf("got metadata %+v, want the collection and every war", metadata)
+	}
+	if len(results) != 2 || results[0].Id != "9001" || results[0].Kind != fgoscript.KindWar {
+		t.Fatalf("got results %+v, want war 9001 and the group", results)
+	}
+	group := results[1]
+	if group.Kind != fgoscript.KindGroup || group.Name != "Group" || len(group.Children) != 2 || group.Count.Lines != 2 {
+		t.Errorf("got %s %q with %d children and %d lines, want the group of both wars", group.Kind, group.Name, len(group.Children), group.Count.Lines)
+	}
+}
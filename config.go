@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"fgo-script-parser/fgoscript"
+)
+
+const (
+	apiURLEnv    = "FGO_ATLAS_API_URL"
+	staticURLEnv = "FGO_ATLAS_STATIC_URL"
+)
+
+// Config holds the settings shared by the TUI and the CLI.
+// Values are read from the config file, then the environment, then flags.
+type Config struct {
+	// Base URL of the Atlas API
+	APIURL string `json:"apiUrl"`
+	// Base URL of the static Atlas host serving script files
+	StaticURL string `json:"staticUrl"`
+	// Directory for cached Atlas responses
+	CacheDir string `json:"cacheDir"`
+	// How long cached responses are used before revalidating them
+	CacheTTL Duration `json:"cacheTtl"`
+	// Disable the cache entirely
+	NoCache bool `json:"noCache"`
+	// Only use cached responses
+	Offline bool `json:"offline"`
+	// Number of retries for failed requests
+	Retries int `json:"retries"`
+	// Delay before the first retry, doubling for each retry after that
+	RetryDelay Duration `json:"retryDelay"`
+	// Maximum number of Atlas requests in flight at once
+	Concurrency int `json:"concurrency"`
+	// Maximum number of Atlas requests per second
+	RateLimit float64 `json:"rateLimit"`
+	// Template of the output file path. The CLI only writes to a file if it's set
+	Output string `json:"output"`
+	// What to do when the output file already exists
+	IfExists ExistsPolicy `json:"ifExists"`
+	// Template file for Markdown and HTML reports, replacing the embedded one
+	Template string `json:"template"`
+	// Path of the SQLite database that runs are recorded in
+	History string `json:"history"`
+	// Record every run in the history database
+	Record bool `json:"record"`
+	// Write the dialogue text of every script to JSON and NDJSON output, so it can be diffed
+	Dialogue bool `json:"dialogue"`
+	// Add the speaker, failed script and duplicate tables to TSV output, after the results
+	TSVSections bool `json:"tsvSections"`
+	// Count scripts with the same contents as a script counted before them in the run
+	KeepDuplicates bool `json:"keepDuplicates"`
+	// Rules file added on top of the built-in special cases for Atlas wars and scripts
+	Rules string `json:"rules"`
+	// Names used for wars in the war table: en, jp, or raw for the names from Atlas and directories
+	Names fgoscript.NameStyle `json:"names"`
+	// Collections file added to the built-in collections of wars
+	Collections string `json:"collections"`
+
+	// Built-in rules with the rules file on top, loaded by loadRules
+	rules *fgoscript.Rules
+	// Built-in collections with the collections file added, loaded by loadCollections
+	collections []Collection
+}
+
+// Duration is a time.Duration read from strings such as "24h" in the config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func DefaultConfig() Config {
+	return Config{
+		APIURL:      fgoscript.DefaultAPIURL,
+		StaticURL:   fgoscript.DefaultStaticURL,
+		CacheDir:    fgoscript.DefaultCacheDir(),
+		CacheTTL:    Duration(24 * time.Hour),
+		Retries:     fgoscript.DefaultRetries,
+		RetryDelay:  Duration(fgoscript.DefaultRetryDelay),
+		Concurrency: fgoscript.DefaultConcurrency,
+		RateLimit:   fgoscript.DefaultRateLimit,
+		IfExists:    Overwrite,
+		History:     defaultHistoryPath(),
+		Names:       fgoscript.NamesEnglish,
+	}
+}
+
+// defaultConfigPath returns the path of the config file in the user config directory
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fgo-script-parser", "config.json")
+}
+
+// defaultRulesPath returns the path of the rules file in the user config directory
+func defaultRulesPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fgo-script-parser", "rules.json")
+}
+
+// loadRules adds the rules file to the built-in rules. If no rules file is set,
+// the default rules file is used if it exists.
+func (c *Config) loadRules() error {
+	c.rules = fgoscript.DefaultRules()
+	path := c.Rules
+	explicit := path != ""
+	if !explicit {
+		path = defaultRulesPath()
+	}
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && (explicit || !errors.Is(err, fs.ErrNotExist)) {
+		return fmt.Errorf("could not read rules file %s. %s", path, err)
+	} else if err != nil {
+		return nil
+	}
+	rules, err := fgoscript.ParseRules(data)
+	if err != nil {
+		return fmt.Errorf("could not parse rules file %s. %s", path, err)
+	}
+	c.rules, err = c.rules.Merge(rules)
+	if err != nil {
+		return fmt.Errorf("could not use rules file %s. %s", path, err)
+	}
+	return nil
+}
+
+// LoadConfig reads the config file at path and applies any environment variables on top.
+// If path is empty, the default config file is used if it exists.
+func LoadConfig(path string) (Config, error) {
+	config := DefaultConfig()
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil && (explicit || !errors.Is(err, fs.ErrNotExist)) {
+			return config, fmt.Errorf("could not read config file %s. %s", path, err)
+		} else if err == nil {
+			err = json.Unmarshal(data, &config)
+			if err != nil {
+				return config, fmt.Errorf("could not parse config file %s. %s", path, err)
+			}
+		}
+	}
+
+	if url := os.Getenv(apiURLEnv); url != "" {
+		config.APIURL = url
+	}
+	if url := os.Getenv(staticURLEnv); url != "" {
+		config.StaticURL = url
+	}
+
+	return config, nil
+}
+
+// cache returns the configured cache, or nil if caching is disabled
+func (c Config) cache() *fgoscript.Cache {
+	if c.NoCache || c.CacheDir == "" {
+		return nil
+	}
+	cache := fgoscript.NewCache(c.CacheDir, time.Duration(c.CacheTTL))
+	cache.Offline = c.Offline
+	return cache
+}
+
+// client returns a fgoscript client for the region using the configured hosts and cache
+func (c Config) client(region fgoscript.Region) *fgoscript.Client {
+	client := fgoscript.NewClient(region)
+	client.APIURL = c.APIURL
+	client.StaticURL = c.StaticURL
+	client.Cache = c.cache()
+	client.Retries = c.Retries
+	client.RetryDelay = time.Duration(c.RetryDelay)
+	client.Concurrency = c.Concurrency
+	client.RateLimit = c.RateLimit
+	// Recorded runs always keep their dialogue, so they can be diffed later
+	client.KeepDialogue = c.Dialogue || c.Record
+	client.KeepDuplicates = c.KeepDuplicates
+	client.Rules = c.rules
+	client.Names = c.Names
+	return client
+}
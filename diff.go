@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fgo-script-parser/fgoscript"
+)
+
+// Diff is the difference between two sets of results
+type Diff struct {
+	Old Metadata `json:"old"`
+	New Metadata `json:"new"`
+	// Only the items that changed. Added and removed items keep their children
+	Changes []fgoscript.ResultDiff `json:"changes"`
+}
+
+// newDiff compares two sets of results
+func newDiff(old, new Metadata, oldResults, newResults []fgoscript.ParseResult) Diff {
+	changes := changedDiffs(fgoscript.DiffResults(oldResults, newResults))
+	if changes == nil {
+		changes = []fgoscript.ResultDiff{}
+	}
+	return Diff{Old: old, New: new, Changes: changes}
+}
+
+// matchSingleFiles gives two single script files, or two single lowest level
+// directories, the same name and ID, so that two versions of a script or a
+// chapter are compared even if their file or directory names differ
+func matchSingleFiles(old, new []fgoscript.ParseResult) {
+	if len(old) != 1 || len(new) != 1 || old[0].Kind != new[0].Kind {
+		return
+	}
+	if old[0].Kind == fgoscript.KindFile || old[0].Kind == fgoscript.KindDirectory {
+		old[0].Id, old[0].Name = new[0].Id, new[0].Name
+	}
+}
+
+// changedDiffs leaves out every unchanged item
+func changedDiffs(diffs []fgoscript.ResultDiff) []fgoscript.ResultDiff {
+	var changed []fgoscript.ResultDiff
+	for _, d := range diffs {
+		if d.Change == fgoscript.Unchanged {
+			continue
+		}
+		if d.Change == fgoscript.Changed {
+			d.Children = changedDiffs(d.Children)
+		}
+		changed = append(changed, d)
+	}
+	return changed
+}
+
+// diffRow is a changed item along with the names of the items it is in
+type diffRow struct {
+	fgoscript.ResultDiff
+	// Names from the top level item down to this one
+	Path  []string
+	Depth int
+}
+
+// flattenDiff lists the changed items depth first. Items that were added or
+// removed are listed without their children
+func flattenDiff(diffs []fgoscript.ResultDiff) []diffRow {
+	var rows []diffRow
+	var walk func(diffs []fgoscript.ResultDiff, path []string)
+	walk = func(diffs []fgoscript.ResultDiff, path []string) {
+		for _, d := range diffs {
+			row := diffRow{ResultDiff: d, Path: append(slices.Clone(path), d.Name), Depth: len(path)}
+			rows = append(rows, row)
+			if d.Change == fgoscript.Changed {
+				walk(d.Children, row.Path)
+			}
+		}
+	}
+	walk(diffs, nil)
+	return rows
+}
+
+// formatDelta formats a difference with its sign, e.g. +12 or -3
+func formatDelta(delta int) string {
+	if delta > 0 {
+		return "+" + strconv.Itoa(delta)
+	}
+	return strconv.Itoa(delta)
+}
+
+// deltaColumns returns the old, new and changed count of every count column
+func deltaColumns(d fgoscript.ResultDiff, includeWordCount bool) []string {
+	columns := []string{
+		strconv.Itoa(d.Old.Lines), strconv.Itoa(d.New.Lines), formatDelta(d.New.Lines - d.Old.Lines),
+		strconv.Itoa(d.Old.Characters), strconv.Itoa(d.New.Characters), formatDelta(d.New.Characters - d.Old.Characters),
+	}
+	if includeWordCount {
+		columns = append(columns, strconv.Itoa(d.Old.WordCount()), strconv.Itoa(d.New.WordCount()), formatDelta(d.New.WordCount()-d.Old.WordCount()))
+	}
+	return columns
+}
+
+// writeDiff writes a diff as JSON, or as a tab-separated list of changed items
+// followed by the dialogue lines added and removed in every changed script
+func writeDiff(w io.Writer, diff Diff, format OutputFormat, includeWordCount bool) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	case FormatTSV:
+	default:
+		return fmt.Errorf("diffs can only be written as tsv or json, not %s", format)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = '\t'
+	header := []string{"Change", "Kind", "Id", "Name", "Old lines", "New lines", "Lines", "Old characters", "New characters", "Characters"}
+	if includeWordCount {
+		header = append(header, "Old words", "New words", "Words")
+	}
+	writer.Write(header)
+	rows := flattenDiff(diff.Changes)
+	for _, row := range rows {
+		columns := []string{string(row.Change), string(row.Kind), row.Id, strings.Join(row.Path, " › ")}
+		writer.Write(append(columns, deltaColumns(row.ResultDiff, includeWordCount)...))
+	}
+
+	// Separate the dialogue from the items with an empty line
+	writer.Write([]string{})
+	writer.Write([]string{"Id", "Name", "Change", "Speaker", "Text"})
+	for _, row := range rows {
+		for _, edit := range row.Dialogue {
+			writer.Write([]string{row.Id, strings.Join(row.Path, " › "), dialogueMarker(edit.Change), edit.Speaker, edit.Text})
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// dialogueMarker returns the diff marker of a dialogue line, + for added and - for removed
+func dialogueMarker(change fgoscript.Change) string {
+	if change == fgoscript.Added {
+		return "+"
+	}
+	return "-"
+}
+
+var runArgRegex = regexp.MustCompile(`^(?:run:)?(\d+)$`)
+
+// loadResultSet loads one side of a diff: a run in the history, given as its
+// ID or run:<ID>, a JSON or NDJSON output file, or script files or a directory to parse
+func loadResultSet(ctx context.Context, client *fgoscript.Client, history, arg string) (Metadata, []fgoscript.ParseResult, error) {
+	_, statErr := os.Stat(arg)
+	if match := runArgRegex.FindStringSubmatch(arg); match != nil && (statErr != nil || strings.HasPrefix(arg, "run:")) {
+		id, _ := strconv.ParseInt(match[1], 10, 64)
+		store, err := OpenStore(history)
+		if err != nil {
+			return Metadata{}, nil, err
+		}
+		defer store.Close()
+		return store.LoadRun(ctx, id)
+	} else if statErr != nil {
+		return Metadata{}, nil, fmt.Errorf("could not get file info for %s. %w", arg, statErr)
+	}
+
+	switch strings.ToLower(filepath.Ext(arg)) {
+	case ".json":
+		return readJSONResults(arg)
+	case ".ndjson":
+		return readNDJSONResults(arg)
+	}
+	client.KeepDialogue = true
+	metadata := newMetadata(client.Region, local, 0, []string{arg})
+	results, err := client.ParseFromLocal(ctx, []string{arg})
+	return metadata, results, err
+}
+
+// readJSONResults reads the metadata and results of a JSON output file
+func readJSONResults(path string) (Metadata, []fgoscript.ParseResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Metadata{}, nil, fmt.Errorf("could not read results file %s. %s", path, err)
+	}
+	var document struct {
+		Metadata Metadata                `json:"metadata"`
+		Results  []fgoscript.ParseResult `json:"results"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return Metadata{}, nil, fmt.Errorf("could not parse results file %s. %s", path, err)
+	}
+	return document.Metadata, document.Results, nil
+}
+
+// readNDJSONResults reads the metadata and result records of an NDJSON output file
+func readNDJSONResults(path string) (Metadata, []fgoscript.ParseResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Metadata{}, nil, fmt.Errorf("could not read results file %s. %s", path, err)
+	}
+	defer file.Close()
+
+	var metadata Metadata
+	var results []fgoscript.ParseResult
+	runs := 0
+	scanner := bufio.NewScanner(file)
+	// Records with dialogue can be much longer than the default line limit
+	scanner.Buffer(nil, 256*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		var record struct {
+			Type string `json:"type"`
+		}
+		line := scanner.Bytes()
+		if err := json.Unmarshal(line, &record); err != nil {
+			return metadata, nil, fmt.Errorf("could not parse line %d of results file %s. %s", n, path, err)
+		}
+		switch record.Type {
+		case "metadata":
+			// Every run appended to the file starts with its own metadata
+			if runs++; runs > 1 {
+				return metadata, nil, fmt.Errorf("results file %s has more than one run appended to it, from line %d. Split it into a file per run to compare them", path, n)
+			}
+			err = json.Unmarshal(line, &metadata)
+		case "result":
+			var result fgoscript.ParseResult
+			err = json.Unmarshal(line, &result)
+			results = append(results, result)
+		}
+		if err != nil {
+			return metadata, nil, fmt.Errorf("could not parse line %d of results file %s. %s", n, path, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return metadata, nil, fmt.Errorf("could not read results file %s. %s", path, err)
+	}
+	if metadata.Tool == "" && len(results) == 0 {
+		return metadata, nil, errors.New("no results found in " + path)
+	}
+	return metadata, results, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+)
+
+func TestMatchSingleFiles(t *testing.T) {
+	tests := []struct {
+		name string
+		old  []fgoscript.ParseResult
+		new  []fgoscript.ParseResult
+		want string
+	}{
+		{
+			"files",
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindFile, Name: "v1"}},
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindFile, Name: "v2"}},
+			"v2",
+		},
+		{
+			"directories",
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindDirectory, Name: "scripts-v1"}},
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindDirectory, Name: "scripts-v2"}},
+			"scripts-v2",
+		},
+		{
+			"directory matched to a war",
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindDirectory, Name: "scripts-v1"}},
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindDirectory, Id: "101", Name: "Orleans"}},
+			"Orleans",
+		},
+		{
+			"file and directory",
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindFile, Name: "v1"}},
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindDirectory, Name: "v2"}},
+			"v1",
+		},
+		{
+			"several directories",
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindDirectory, Name: "a"}},
+			[]fgoscript.ParseResult{{Kind: fgoscript.KindDirectory, Name: "b"}, {Kind: fgoscript.KindDirectory, Name: "c"}},
+			"a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchSingleFiles(tt.old, tt.new)
+			if tt.old[0].Name != tt.want {
+				t.Errorf("got name %q, want %q", tt.old[0].Name, tt.want)
+			}
+			if tt.want == tt.new[0].Name && tt.old[0].Id != tt.new[0].Id {
+				t.Errorf("got ID %q, want %q", tt.old[0].Id, tt.new[0].Id)
+			}
+		})
+	}
+}
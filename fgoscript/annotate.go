@@ -0,0 +1,134 @@
+package fgoscript
+
+import "strings"
+
+// SpanKind is how a part of a script line was treated when counting
+type SpanKind int
+
+const (
+	// Text that isn't counted, such as text outside of a closed speaker block
+	// or after a [k] page break
+	SpanPlain SpanKind = iota
+	// Dialogue text that was counted
+	SpanCounted
+	// Tags and tag syntax, which are stripped before counting
+	SpanTag
+	// Speaker and choice markers, which start a counted line but add no characters
+	SpanMarker
+)
+
+// Span is a part of a script line
+type Span struct {
+	Text string
+	Kind SpanKind
+}
+
+// AnnotatedLine is a single line of a script, split into the parts that were
+// counted and the parts that were stripped
+type AnnotatedLine struct {
+	// 1-based line number in the script
+	Number int
+	Spans  []Span
+	// Characters and words counted on this line
+	Characters int
+	Words      int
+	// Set on the line a counted dialogue line or choice starts on
+	Match *Match
+}
+
+// Match is a single counted dialogue line or choice, and the count it contributed
+type Match struct {
+	Speaker    string
+	Characters int
+	Words      int
+}
+
+// AnnotateScript returns every line of a script annotated with how it was
+// counted. The counts add up to the count returned by CountScript.
+func AnnotateScript(data string, mode CountMode) []AnnotatedLine {
+	lines := strings.Split(data, "\n")
+	annotated := make([]AnnotatedLine, len(lines))
+	for i := range annotated {
+		annotated[i].Number = i + 1
+	}
+
+	// Find the counted lines from the document, so the annotations follow the same rules
+	counted := make(map[int]bool)
+	countLine := func(match *Match, l *TextLine) {
+		a := &annotated[l.Line-1]
+		counted[l.Line] = true
+		a.Characters += l.characters()
+		match.Characters += l.characters()
+		if mode == CountWords {
+			a.Words += l.words()
+			match.Words += l.words()
+		}
+	}
+	for _, n := range ParseScript(data).Nodes {
+		switch n := n.(type) {
+		case *SpeakerBlock:
+			if !n.Closed {
+				continue
+			}
+			match := &Match{Speaker: n.speaker()}
+			for _, l := range n.Lines {
+				countLine(match, l)
+			}
+			annotated[n.Line-1].Match = match
+		case *Choice:
+			match := &Match{Speaker: ChoiceSpeaker}
+			countLine(match, n.Text)
+			annotated[n.Text.Line-1].Match = match
+		}
+	}
+
+	// Split each line into spans using the same tokens the parser reads
+	var pageBreak bool
+	for _, t := range lex(data) {
+		if t.typ == tokenEOF {
+			break
+		}
+		a := &annotated[t.line-1]
+		switch t.typ {
+		case tokenSpeaker, tokenChoiceEnd:
+			a.Spans = append(a.Spans, Span{Text: strings.TrimSuffix(lines[t.line-1], "\r"), Kind: SpanMarker})
+		case tokenChoice:
+			a.Spans = append(a.Spans, Span{Text: "？" + t.value + "：", Kind: SpanMarker})
+		case tokenText:
+			kind := SpanPlain
+			if counted[t.line] && !pageBreak {
+				kind = SpanCounted
+			}
+			a.Spans = append(a.Spans, Span{Text: t.value, Kind: kind})
+		case tokenTag:
+			a.Spans = append(a.Spans, tagSpans(t.value, counted[t.line] && !pageBreak)...)
+			if t.value == "k" {
+				pageBreak = true
+			}
+		case tokenNewline:
+			pageBreak = false
+		}
+	}
+	return annotated
+}
+
+// tagSpans splits a tag into its syntax and, for ruby and gender tags on
+// counted lines, the text that was counted
+func tagSpans(tag string, counted bool) []Span {
+	if !counted || !(strings.HasPrefix(tag, "#") || strings.HasPrefix(tag, "&")) {
+		return []Span{{Text: "[" + tag + "]", Kind: SpanTag}}
+	}
+
+	first, second, found := strings.Cut(tag[1:], ":")
+	spans := []Span{{Text: "[" + tag[:1], Kind: SpanTag}}
+	if first != "" {
+		spans = append(spans, Span{Text: first, Kind: SpanCounted})
+	}
+	if found {
+		spans = append(spans, Span{Text: ":", Kind: SpanTag})
+		if second != "" {
+			spans = append(spans, Span{Text: second, Kind: SpanCounted})
+		}
+	}
+	return append(spans, Span{Text: "]", Kind: SpanTag})
+}
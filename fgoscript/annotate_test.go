@@ -0,0 +1,71 @@
+package fgoscript
+
+import (
+	"strings"
+	"testing"
+)
+
+var annotateScripts = []string{
+	"＠A：マシュ\n一行目\n二行目\n[k]\n",
+	"＠A：マシュ\nこんにちは\n",
+	"＠A：マシュ\nあい[k]うえ\n",
+	"＠\n静かな夜。\n[k]\n",
+	"[scene 10000]\n地の文\n[k]\n",
+	"？1：はい\n？2：いいえ\n？！\n",
+	"＠A：マシュ\n[#先輩:せんぱい]、[&男:女]です！\n[k]\n",
+	"＠A：Mash\r\nSenpai, [line 3] are you okay?\r\n[k]\r\n",
+}
+
+func TestAnnotateScriptMatchesCount(t *testing.T) {
+	for _, script := range annotateScripts {
+		for _, mode := range []CountMode{CountCharacters, CountWords} {
+			want := CountScript(script, mode)
+			var got Count
+			for _, line := range AnnotateScript(script, mode) {
+				got.Characters += line.Characters
+				got.Words += line.Words
+				if line.Match != nil {
+					got.Lines++
+				}
+			}
+			if got.Lines != want.Lines || got.Characters != want.Characters || got.Words != want.Words {
+				t.Errorf("%q in mode %d: got %+v from the annotations, want %+v", script, mode, got, want)
+			}
+		}
+	}
+}
+
+func TestAnnotateScriptKeepsText(t *testing.T) {
+	for _, script := range annotateScripts {
+		lines := strings.Split(script, "\n")
+		for i, line := range AnnotateScript(script, CountCharacters) {
+			var text strings.Builder
+			for _, span := range line.Spans {
+				text.WriteString(span.Text)
+			}
+			if want := strings.TrimSuffix(lines[i], "\r"); text.String() != want {
+				t.Errorf("line %d of %q: got spans %q, want %q", line.Number, script, text.String(), want)
+			}
+		}
+	}
+}
+
+func TestAnnotateScriptSpans(t *testing.T) {
+	lines := AnnotateScript("＠A：マシュ\n[#先輩:せんぱい]、[k]後\n[k]\n", CountCharacters)
+	if lines[0].Match == nil || lines[0].Match.Speaker != "マシュ" || lines[0].Spans[0].Kind != SpanMarker {
+		t.Errorf("got speaker line %+v, want a marker starting the match", lines[0])
+	}
+	want := []Span{
+		{"[#", SpanTag}, {"先輩", SpanCounted}, {":", SpanTag}, {"せんぱい", SpanCounted}, {"]", SpanTag},
+		{"、", SpanCounted}, {"[k]", SpanTag}, {"後", SpanPlain},
+	}
+	got := lines[1].Spans
+	if len(got) != len(want) {
+		t.Fatalf("got spans %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("span %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
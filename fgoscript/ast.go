@@ -0,0 +1,171 @@
+package fgoscript
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed script
+type Document struct {
+	Nodes []Node
+}
+
+// Node is a top level element of a script
+type Node interface {
+	node()
+}
+
+// SpeakerBlock is a single dialogue message, starting with a ＠ line and
+// ending with a [k] page break. Narration is a block without a name.
+type SpeakerBlock struct {
+	// Character slot the message is tied to, e.g. A in ＠A：name. Empty if there is none
+	Slot string
+	Name string
+	// Every line between the ＠ line and the [k] page break
+	Lines []*TextLine
+	// Whether the block was ended by a [k] page break. Unterminated blocks are not dialogue
+	Closed bool
+	// 1-based line number of the ＠ line
+	Line int
+}
+
+// Choice is a player choice line, e.g. ？1：text
+type Choice struct {
+	Number string
+	Text   *TextLine
+}
+
+// ChoiceEnd is the ？！ line closing a set of choices
+type ChoiceEnd struct {
+	Line int
+}
+
+// TextLine is a single line of text and inline tags
+type TextLine struct {
+	Inlines []Inline
+	// 1-based line number in the script
+	Line int
+}
+
+// PageBreak is a [k] outside of a speaker block
+type PageBreak struct {
+	Line int
+}
+
+func (*SpeakerBlock) node() {}
+func (*Choice) node()       {}
+func (*ChoiceEnd) node()    {}
+func (*TextLine) node()     {}
+func (*PageBreak) node()    {}
+
+// Inline is an element of a text line
+type Inline interface {
+	inline()
+}
+
+// Text is plain dialogue text
+type Text struct {
+	Value string
+}
+
+// Ruby is a [#base:reading] ruby tag. Emphasis tags, [#base], have no reading.
+type Ruby struct {
+	Base    string
+	Reading string
+}
+
+// Gender is a [&male:female] tag, which shows different text depending on the player's gender
+type Gender struct {
+	Male   string
+	Female string
+}
+
+// FunctionTag is any other tag, such as [r], [line 3] or [image *]
+type FunctionTag struct {
+	Name string
+	Args []string
+}
+
+func (*Text) inline()        {}
+func (*Ruby) inline()        {}
+func (*Gender) inline()      {}
+func (*FunctionTag) inline() {}
+
+// Count walks the document and counts its dialogue lines and characters.
+//
+// Every closed speaker block and every choice counts as one line. Characters
+// are counted for text, both parts of ruby and gender tags, and nothing for
+// function tags or speaker names. Lines are also counted per speaker, with
+// narration and player choices in their own buckets. With CountWords, the
+// same text is also split into words on spaces and function tags.
+func (d *Document) Count(mode CountMode) Count {
+	var c Count
+	for _, n := range d.Nodes {
+		switch n := n.(type) {
+		case *SpeakerBlock:
+			if !n.Closed {
+				continue
+			}
+			characters, words := 0, 0
+			for _, l := range n.Lines {
+				characters += l.characters()
+				if mode == CountWords {
+					words += l.words()
+				}
+			}
+			c.addLine(n.speaker(), characters, words)
+		case *Choice:
+			words := 0
+			if mode == CountWords {
+				words = n.Text.words()
+			}
+			c.addLine(ChoiceSpeaker, n.Text.characters(), words)
+		}
+	}
+	return c
+}
+
+// speaker returns the name the block is counted under
+func (b *SpeakerBlock) speaker() string {
+	name := strings.TrimSpace(b.Name)
+	if name == "" {
+		return NarrationSpeaker
+	}
+	return name
+}
+
+func (l *TextLine) characters() int {
+	characters := 0
+	for _, i := range l.Inlines {
+		switch i := i.(type) {
+		case *Text:
+			characters += utf8.RuneCountInString(i.Value)
+		case *Ruby:
+			characters += utf8.RuneCountInString(i.Base) + utf8.RuneCountInString(i.Reading)
+		case *Gender:
+			characters += utf8.RuneCountInString(i.Male) + utf8.RuneCountInString(i.Female)
+		}
+	}
+	return characters
+}
+
+func (l *TextLine) words() int {
+	var sb strings.Builder
+	for _, i := range l.Inlines {
+		switch i := i.(type) {
+		case *Text:
+			sb.WriteString(i.Value)
+		case *Ruby:
+			sb.WriteString(i.Base)
+			if i.Reading != "" {
+				sb.WriteString(" " + i.Reading)
+			}
+		case *Gender:
+			sb.WriteString(i.Male + " " + i.Female)
+		case *FunctionTag:
+			// Tags like [r] separate words even without spaces around them
+			sb.WriteString(" ")
+		}
+	}
+	return len(strings.Fields(sb.String()))
+}
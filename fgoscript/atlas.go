@@ -0,0 +1,605 @@
+package fgoscript
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zoox/fetch"
+	"golang.org/x/sync/errgroup"
+)
+
+// AtlasIdType is the kind of ID to fetch scripts for from Atlas DB
+type AtlasIdType int
+
+const (
+	IdTypeWar AtlasIdType = iota
+	IdTypeQuest
+	IdTypeScript
+)
+
+func (t AtlasIdType) String() string {
+	switch t {
+	case IdTypeWar:
+		return "war"
+	case IdTypeQuest:
+		return "quest"
+	case IdTypeScript:
+		return "script"
+	}
+	return fmt.Sprintf("AtlasIdType(%d)", int(t))
+}
+
+// ParseAtlasIdType returns the AtlasIdType for "war", "quest" or "script"
+func ParseAtlasIdType(s string) (AtlasIdType, error) {
+	switch s {
+	case "war":
+		return IdTypeWar, nil
+	case "quest":
+		return IdTypeQuest, nil
+	case "script":
+		return IdTypeScript, nil
+	}
+	return 0, fmt.Errorf("unknown Atlas ID type %q. Must be one of war, quest or script", s)
+}
+
+// Script is a script reference as returned by the Atlas API
+type Script struct {
+	ScriptId string `json:"scriptId"`
+	Script   string `json:"script"`
+	// Quest and phase the script was found in. Not part of the API response
+	QuestId   int    `json:"-"`
+	QuestName string `json:"-"`
+	Phase     int    `json:"-"`
+}
+
+// Quest is the subset of an Atlas quest needed to find its scripts
+type Quest struct {
+	Name         string `json:"name"`
+	Id           int    `json:"id"`
+	Type         string `json:"type"`
+	PhaseScripts []struct {
+		Phase   int `json:"phase"`
+		Scripts []Script
+	}
+}
+
+// War is the subset of an Atlas war needed to find its scripts
+type War struct {
+	Name     string `json:"name"`
+	LongName string `json:"longName"`
+	Spots    []struct {
+		Quests []Quest
+	}
+}
+
+const (
+	// DefaultAPIURL is the base URL of the public Atlas API
+	DefaultAPIURL = "https://api.atlasacademy.io"
+	// DefaultStaticURL is the base URL of the public Atlas host for script files
+	DefaultStaticURL = "https://static.atlasacademy.io"
+
+	DefaultRetries     = 3
+	DefaultRetryDelay  = 500 * time.Millisecond
+	DefaultConcurrency = 8
+	DefaultRateLimit   = 20
+)
+
+// Client fetches and counts scripts for a single region
+type Client struct {
+	Region Region
+	// Base URL of the Atlas API, e.g. to use a mirror. Defaults to DefaultAPIURL
+	APIURL string
+	// Base URL of the static host serving script files. Defaults to DefaultStaticURL
+	StaticURL string
+	// Cache for API responses and script files. Nil disables caching
+	Cache *Cache
+	// Number of times a request is retried after a transient failure
+	Retries int
+	// Delay before the first retry. It doubles for every retry after that
+	RetryDelay time.Duration
+	// Maximum number of requests in flight at once, and of scripts being fetched and
+	// counted at once across every call. Zero or less means no limit
+	Concurrency int
+	// Maximum number of requests per second. Zero or less means no limit
+	RateLimit float64
+	// Called with the client's progress every time it changes. Calls are never concurrent
+	OnProgress func(Progress)
+	// Keep the dialogue text of every script in its result, e.g. to diff it later
+	KeepDialogue bool
+	// Count scripts with the same contents as a script counted before them in the
+	// same call, instead of leaving them out. See ExcludeDuplicates
+	KeepDuplicates bool
+	// Special cases applied when fetching from Atlas. Nil uses DefaultRules
+	Rules *Rules
+	// Which names are used for wars in the war table, for Atlas wars and the local
+	// directories matched to them. Empty uses the canonical English names
+	Names NameStyle
+
+	// Shared by every request made by the client, set up on the first request
+	initLimits sync.Once
+	slots      chan struct{}
+	workers    chan struct{}
+	limiter    *limiter
+
+	initProgress sync.Once
+	progress     *progressTracker
+}
+
+// DefaultClient is the client used by the package level functions. It uses the JP region
+var DefaultClient = NewClient(RegionJP)
+
+// NewClient returns a client for the given region using the public Atlas hosts
+func NewClient(region Region) *Client {
+	return &Client{
+		Region:      region,
+		APIURL:      DefaultAPIURL,
+		StaticURL:   DefaultStaticURL,
+		Retries:     DefaultRetries,
+		RetryDelay:  DefaultRetryDelay,
+		Concurrency: DefaultConcurrency,
+		RateLimit:   DefaultRateLimit,
+	}
+}
+
+// ParseFromAtlas fetches and counts the scripts for each ID using DefaultClient
+func ParseFromAtlas(ctx context.Context, ids []string, idType AtlasIdType) ([]ParseResult, error) {
+	return DefaultClient.ParseFromAtlas(ctx, ids, idType)
+}
+
+// FetchWarScripts returns the scripts in a war using DefaultClient
+func FetchWarScripts(ctx context.Context, id string) ([]Script, string, error) {
+	return DefaultClient.FetchWarScripts(ctx, id)
+}
+
+// FetchQuestScripts returns the scripts in a quest using DefaultClient
+func FetchQuestScripts(ctx context.Context, id string) ([]Script, string, error) {
+	return DefaultClient.FetchQuestScripts(ctx, id)
+}
+
+// FetchSingleScript fetches and counts a single script using DefaultClient
+func FetchSingleScript(ctx context.Context, id string) (ParseResult, error) {
+	return DefaultClient.FetchSingleScript(ctx, id)
+}
+
+// ParseFromAtlas fetches and counts the scripts for each ID, returning one result per ID.
+// The IDs are parsed concurrently, sharing the client's concurrency and rate limits.
+// If parsing stops early, for example because ctx is cancelled, the results
+// completed before that are returned along with the error.
+// Duplicate scripts are left out unless the client keeps them, and script IDs
+// are filtered by the client's rules like the scripts of a war or quest.
+func (c *Client) ParseFromAtlas(ctx context.Context, ids []string, idType AtlasIdType) ([]ParseResult, error) {
+	if idType == IdTypeScript {
+		ids = c.rules().filterIds(ids)
+	}
+	results := make([]ParseResult, len(ids))
+	done := make([]bool, len(ids))
+	if idType == IdTypeWar {
+		c.tracker().addWars(len(ids))
+	}
+	g, ctx := errgroup.WithContext(ctx)
+	for i, id := range ids {
+		g.Go(func() error {
+			result, err := c.parseAtlasId(ctx, id, idType)
+			if err != nil {
+				return err
+			}
+			results[i] = result
+			done[i] = true
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		var completed []ParseResult
+		for i, r := range results {
+			if done[i] {
+				completed = append(completed, r)
+			}
+		}
+		return c.excludeDuplicates(completed), err
+	}
+
+	return c.excludeDuplicates(results), nil
+}
+
+// parseAtlasId fetches and counts the scripts for a single ID
+func (c *Client) parseAtlasId(ctx context.Context, id string, idType AtlasIdType) (ParseResult, error) {
+	switch idType {
+	case IdTypeWar:
+		scripts, name, err := c.FetchWarScripts(ctx, id)
+		if err != nil {
+			return ParseResult{}, err
+		}
+		rule := c.rules().Wars[id]
+		for _, questId := range rule.ExtraQuests {
+			s, _, err := c.FetchQuestScripts(ctx, questId)
+			if err != nil {
+				return ParseResult{}, err
+			}
+			scripts = append(scripts, s...)
+		}
+		war, found := FindWar(id)
+		if found {
+			name = war.Name(c.Names, name)
+		}
+		if rule.Name != "" {
+			name = rule.Name
+		}
+
+		result, err := c.ParseScripts(ctx, c.rules().filterScripts(uniqueScripts(scripts)), name)
+		if err != nil {
+			return ParseResult{}, err
+		}
+		c.tracker().warDone()
+		result.Id = id
+		result.Kind = KindWar
+		result.Arc = war.Arc
+		return result, nil
+	case IdTypeQuest:
+		scripts, name, err := c.FetchQuestScripts(ctx, id)
+		if err != nil {
+			return ParseResult{}, err
+		}
+
+		result, err := c.ParseScripts(ctx, c.rules().filterScripts(uniqueScripts(scripts)), name)
+		if err != nil {
+			return ParseResult{}, err
+		}
+		// Skip the quest level, since the result is the quest itself
+		if len(result.Children) == 1 && result.Children[0].Kind == KindQuest {
+			result.Children = result.Children[0].Children
+		}
+		result.Id = id
+		result.Kind = KindQuest
+		return result, nil
+	case IdTypeScript:
+		result, err := c.FetchSingleScript(ctx, id)
+		if err != nil {
+			return ParseResult{}, err
+		}
+		result.Id = id
+		return result, nil
+	}
+
+	return ParseResult{}, fmt.Errorf("unknown Atlas ID type %s", idType)
+}
+
+// uniqueScripts removes scripts listed more than once, keeping the first one
+func uniqueScripts(scripts []Script) []Script {
+	seen := make(map[string]bool, len(scripts))
+	var unique []Script
+	for _, script := range scripts {
+		if seen[script.ScriptId] {
+			continue
+		}
+		seen[script.ScriptId] = true
+		unique = append(unique, script)
+	}
+	return unique
+}
+
+// ParseScripts fetches and counts every script concurrently, returning the combined count.
+// Scripts are fetched by a pool of workers shared by every call on the client, the size of
+// the client's concurrency limit, so a run never has more scripts in progress than that.
+// The result's children are the quests the scripts were found in, split into phases and
+// then scripts. Scripts that can't be fetched, even after retrying, are listed in the
+// result's Failed scripts instead of failing the whole result.
+func (c *Client) ParseScripts(ctx context.Context, scripts []Script, name string) (ParseResult, error) {
+	counts := make([]ParseResult, len(scripts))
+	wg := sync.WaitGroup{}
+	c.tracker().addScripts(scripts)
+	for i, script := range scripts {
+		release, err := c.acquireWorker(ctx)
+		if err != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer release()
+			result, err := c.fetchScript(ctx, script)
+			c.tracker().scriptDone(script)
+			result.Id, result.Name, result.Kind, result.Source = script.ScriptId, script.ScriptId, KindScript, c.scriptURL(script.Script)
+			if err != nil {
+				result.Failed = []*ScriptError{{ScriptId: script.ScriptId, Err: err}}
+			}
+			counts[i] = result
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return ParseResult{}, err
+	}
+	result := newParentResult("", "", name, questResults(scripts, counts))
+	slices.SortFunc(result.Failed, func(a, b *ScriptError) int {
+		return strings.Compare(a.ScriptId, b.ScriptId)
+	})
+	return result, nil
+}
+
+// questResults groups the script results by quest and phase, in the order they were listed.
+// Scripts without a quest are left ungrouped
+func questResults(scripts []Script, counts []ParseResult) []ParseResult {
+	type phaseKey struct{ quest, phase int }
+	var questOrder []int
+	questPhases := make(map[int][]int)
+	questNames := make(map[int]string)
+	phases := make(map[phaseKey][]ParseResult)
+	var ungrouped []ParseResult
+	for i, script := range scripts {
+		if script.QuestId == 0 {
+			ungrouped = append(ungrouped, counts[i])
+			continue
+		}
+		if _, found := questPhases[script.QuestId]; !found {
+			questOrder = append(questOrder, script.QuestId)
+			questNames[script.QuestId] = script.QuestName
+		}
+		key := phaseKey{script.QuestId, script.Phase}
+		if _, found := phases[key]; !found {
+			questPhases[script.QuestId] = append(questPhases[script.QuestId], script.Phase)
+		}
+		phases[key] = append(phases[key], counts[i])
+	}
+
+	var quests []ParseResult
+	for _, questId := range questOrder {
+		var children []ParseResult
+		for _, phase := range questPhases[questId] {
+			id := fmt.Sprint(phase)
+			children = append(children, newParentResult(KindPhase, id, "Phase "+id, phases[phaseKey{questId, phase}]))
+		}
+		quests = append(quests, newParentResult(KindQuest, fmt.Sprint(questId), questNames[questId], children))
+	}
+	return append(quests, ungrouped...)
+}
+
+// fetchScript fetches and counts a script file listed by the API
+func (c *Client) fetchScript(ctx context.Context, script Script) (ParseResult, error) {
+	c.tracker().fetching("script", script.ScriptId)
+	response, err := c.get(ctx, c.scriptURL(script.Script))
+	if err != nil {
+		return ParseResult{}, err
+	} else if response.StatusCode() != http.StatusOK {
+		return ParseResult{}, fmt.Errorf("unexpected status %d", response.StatusCode())
+	}
+	return c.scriptResult(response.String()), nil
+}
+
+// FetchWarScripts returns every main quest script in a war, along with the war name
+func (c *Client) FetchWarScripts(ctx context.Context, id string) ([]Script, string, error) {
+	var result War
+	c.tracker().fetching("war", id)
+	response, err := c.get(ctx, c.apiURL("war", id))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get data for war with ID %s. %w", id, err)
+	} else if response.StatusCode() == 404 {
+		return nil, "", fmt.Errorf("could not get data for war with ID %s. Make sure the ID is correct", id)
+	} else if response.StatusCode() != http.StatusOK {
+		return nil, "", fmt.Errorf("could not get data for war with ID %s. Unexpected status %d", id, response.StatusCode())
+	}
+	err = response.UnmarshalJSON(&result)
+	if err != nil {
+		return nil, "", fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+
+	var scripts []Script
+	for _, spot := range result.Spots {
+		for _, quest := range spot.Quests {
+			// This works for both main story and event quests
+			if quest.Type == "main" {
+				for _, phase := range quest.PhaseScripts {
+					for _, script := range phase.Scripts {
+						script.QuestId, script.QuestName, script.Phase = quest.Id, quest.Name, phase.Phase
+						scripts = append(scripts, script)
+					}
+				}
+			}
+		}
+	}
+	// TODO: Might be needed for the other fetching functions as well
+	name := result.Name
+	if result.Name == "-" {
+		name = result.LongName
+	}
+	return scripts, name, nil
+}
+
+// FetchQuestScripts returns every script in a quest, along with the quest name
+func (c *Client) FetchQuestScripts(ctx context.Context, id string) ([]Script, string, error) {
+	var result Quest
+	c.tracker().fetching("quest", id)
+	response, err := c.get(ctx, c.apiURL("quest", id))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not get data for quest with ID %s. %w", id, err)
+	} else if response.StatusCode() == 404 {
+		return nil, "", fmt.Errorf("could not get data for quest with ID %s. Make sure the ID is correct", id)
+	} else if response.StatusCode() != http.StatusOK {
+		return nil, "", fmt.Errorf("could not get data for quest with ID %s. Unexpected status %d", id, response.StatusCode())
+	}
+	err = response.UnmarshalJSON(&result)
+	if err != nil {
+		return nil, "", fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+
+	var scripts []Script
+	for _, phase := range result.PhaseScripts {
+		for _, script := range phase.Scripts {
+			script.QuestId, script.QuestName, script.Phase = result.Id, result.Name, phase.Phase
+			scripts = append(scripts, script)
+		}
+	}
+
+	return scripts, result.Name, nil
+}
+
+// FetchSingleScript fetches and counts a single script by its ID
+func (c *Client) FetchSingleScript(ctx context.Context, id string) (ParseResult, error) {
+	if len(id) < 2 {
+		return ParseResult{}, fmt.Errorf("invalid script ID %s", id)
+	}
+	script := Script{ScriptId: id}
+	c.tracker().addScripts([]Script{script})
+	c.tracker().fetching("script", id)
+	defer c.tracker().scriptDone(script)
+	url := fmt.Sprintf("%s/%s/Script/%s/%s.txt", c.staticBase(), c.Region, id[0:2], id)
+	response, err := c.get(ctx, url)
+	if err != nil {
+		return ParseResult{}, fmt.Errorf("error fetching script %s. %w", id, err)
+	} else if response.StatusCode() == 404 {
+		return ParseResult{}, fmt.Errorf("error fetching script %s. Make sure the ID is correct", id)
+	} else if response.StatusCode() != http.StatusOK {
+		return ParseResult{}, fmt.Errorf("error fetching script %s. Unexpected status %d", id, response.StatusCode())
+	}
+	result := c.scriptResult(response.String())
+	result.Name = id
+	result.Kind = KindScript
+	result.Source = url
+	return result, nil
+}
+
+// FetchSource returns the contents of the script a result was counted from,
+// fetching it from Atlas or reading it from disk
+func (c *Client) FetchSource(ctx context.Context, result ParseResult) (string, error) {
+	switch {
+	case result.Source == "":
+		return "", fmt.Errorf("%s is not a single script", result.Name)
+	case result.Kind == KindFile:
+		data, err := os.ReadFile(result.Source)
+		if err != nil {
+			return "", fmt.Errorf("can't read file: %s. %w", result.Source, err)
+		}
+		return string(data), nil
+	}
+
+	response, err := c.get(ctx, result.Source)
+	if err != nil {
+		return "", fmt.Errorf("error fetching script %s. %w", result.Id, err)
+	} else if response.StatusCode() != http.StatusOK {
+		return "", fmt.Errorf("error fetching script %s. Unexpected status %d", result.Id, response.StatusCode())
+	}
+	return response.String(), nil
+}
+
+// apiURL returns the nice API URL for a war or quest. Names are translated
+// to English for JP, which is the only region Atlas has translations for.
+func (c *Client) apiURL(endpoint, id string) string {
+	url := fmt.Sprintf("%s/nice/%s/%s/%s", c.apiBase(), c.Region, endpoint, id)
+	if c.Region == RegionJP {
+		url += "?lang=en"
+	}
+	return url
+}
+
+// scriptURL returns the URL of a script file listed by the API, pointed at
+// the configured static host instead of the public one
+func (c *Client) scriptURL(url string) string {
+	if rest, found := strings.CutPrefix(url, DefaultStaticURL); found {
+		return c.staticBase() + rest
+	}
+	return url
+}
+
+func (c *Client) apiBase() string {
+	if c.APIURL == "" {
+		return DefaultAPIURL
+	}
+	return strings.TrimSuffix(c.APIURL, "/")
+}
+
+func (c *Client) staticBase() string {
+	if c.StaticURL == "" {
+		return DefaultStaticURL
+	}
+	return strings.TrimSuffix(c.StaticURL, "/")
+}
+
+func (c *Client) get(ctx context.Context, url string) (*fetch.Response, error) {
+	if c.Cache != nil {
+		return c.Cache.get(ctx, url, c.request)
+	}
+	return c.request(ctx, url, nil)
+}
+
+// request makes a GET request, retrying transient failures with exponential backoff
+func (c *Client) request(ctx context.Context, url string, headers fetch.Headers) (*fetch.Response, error) {
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		response, err := c.limitedGet(ctx, url, headers)
+		if attempt >= c.Retries || !isTransient(ctx, response, err) {
+			return response, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// setUpLimits creates the limits shared by every request and script of the client
+func (c *Client) setUpLimits() {
+	c.initLimits.Do(func() {
+		if c.Concurrency > 0 {
+			c.slots = make(chan struct{}, c.Concurrency)
+			c.workers = make(chan struct{}, c.Concurrency)
+		}
+		if c.RateLimit > 0 {
+			c.limiter = newLimiter(c.RateLimit)
+		}
+	})
+}
+
+// acquireWorker waits until a script worker is free and returns the function that frees it again
+func (c *Client) acquireWorker(ctx context.Context) (func(), error) {
+	c.setUpLimits()
+	if c.workers == nil {
+		return func() {}, ctx.Err()
+	}
+	select {
+	case c.workers <- struct{}{}:
+		return func() { <-c.workers }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// limitedGet makes a single GET request once the concurrency and rate limits allow it
+func (c *Client) limitedGet(ctx context.Context, url string, headers fetch.Headers) (*fetch.Response, error) {
+	c.setUpLimits()
+
+	if c.slots != nil {
+		select {
+		case c.slots <- struct{}{}:
+			defer func() { <-c.slots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if c.limiter != nil {
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return fetch.Get(url, &fetch.Config{Context: ctx, Headers: headers})
+}
+
+// isTransient reports whether a failed request is worth retrying
+func isTransient(ctx context.Context, response *fetch.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return response.Status == http.StatusTooManyRequests || response.Status >= http.StatusInternalServerError
+}
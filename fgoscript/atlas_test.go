@@ -0,0 +1,432 @@
+package fgoscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// atlasServer is a fake Atlas API and static host
+type atlasServer struct {
+	*httptest.Server
+	mu sync.Mutex
+	// Requests per path
+	requests map[string]int
+	// Responses per path, used in order. The last one is repeated
+	responses map[string][]atlasResponse
+}
+
+type atlasResponse struct {
+	status int
+	body   string
+}
+
+func newAtlasServer(t *testing.T) *atlasServer {
+	s := &atlasServer{requests: make(map[string]int), responses: make(map[string][]atlasResponse)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		n := s.requests[r.URL.Path]
+		s.requests[r.URL.Path]++
+		responses, found := s.responses[r.URL.Path]
+		s.mu.Unlock()
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+		response := responses[min(n, len(responses)-1)]
+		w.WriteHeader(response.status)
+		fmt.Fprint(w, response.body)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// handle sets the responses for a path
+func (s *atlasServer) handle(path string, responses ...atlasResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[path] = responses
+}
+
+func (s *atlasServer) requestCount(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+// client returns a client for the server without limits and with short retry delays
+func (s *atlasServer) client() *Client {
+	c := NewClient(RegionJP)
+	c.APIURL, c.StaticURL = s.URL, s.URL
+	c.RetryDelay = time.Millisecond
+	c.RateLimit = 0
+	return c
+}
+
+// scriptJSON is a script listed by the API, pointed at the public static host
+func scriptJSON(id string) string {
+	return fmt.Sprintf(`{"scriptId": %q, "script": "%s/JP/Script/%s/%s.txt"}`, id, DefaultStaticURL, id[:2], id)
+}
+
+const testScript = "＠A：マシュ\n先輩！\n[k]\n？1：はい\n？！\n"
+
+func TestFetchWarScripts(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/nice/JP/war/9001", atlasResponse{http.StatusOK, `{
+		"name": "-",
+		"longName": "Test War",
+		"spots": [{"quests": [
+			{"id": 1, "name": "Main", "type": "main", "phaseScripts": [{"phase": 1, "scripts": [` + scriptJSON("9001000010") + `]}]},
+			{"id": 2, "name": "Free", "type": "free", "phaseScripts": [{"phase": 1, "scripts": [` + scriptJSON("9001000020") + `]}]}
+		]}]
+	}`})
+
+	scripts, name, err := s.client().FetchWarScripts(context.Background(), "9001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Test War" {
+		t.Errorf("got name %q, want the long name", name)
+	}
+	if len(scripts) != 1 || scripts[0].ScriptId != "9001000010" || scripts[0].QuestId != 1 || scripts[0].Phase != 1 {
+		t.Errorf("got scripts %+v, want only the main quest script", scripts)
+	}
+}
+
+func TestFetchQuestScripts(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/nice/JP/quest/9001", atlasResponse{http.StatusOK, `{
+		"id": 9001, "name": "Test Quest", "type": "free",
+		"phaseScripts": [
+			{"phase": 1, "scripts": [` + scriptJSON("9001000010") + `]},
+			{"phase": 2, "scripts": [` + scriptJSON("9001000020") + `]}
+		]
+	}`})
+
+	scripts, name, err := s.client().FetchQuestScripts(context.Background(), "9001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "Test Quest" || len(scripts) != 2 || scripts[1].Phase != 2 || scripts[1].QuestName != "Test Quest" {
+		t.Errorf("got %q with scripts %+v", name, scripts)
+	}
+}
+
+func TestFetchSingleScript(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/JP/Script/90/9001000010.txt", atlasResponse{http.StatusOK, testScript})
+
+	result, err := s.client().FetchSingleScript(context.Background(), "9001000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count.Lines != 2 || result.Count.Characters != 5 {
+		t.Errorf("got %d lines and %d characters, want 2 and 5", result.Count.Lines, result.Count.Characters)
+	}
+	if want := s.URL + "/JP/Script/90/9001000010.txt"; result.Source != want {
+		t.Errorf("got source %q, want %q", result.Source, want)
+	}
+}
+
+func TestParseFromAtlasWar(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/nice/JP/war/9001", atlasResponse{http.StatusOK, `{
+		"name": "Test War",
+		"spots": [{"quests": [
+			{"id": 1, "name": "Main", "type": "main", "phaseScripts": [{"phase": 1, "scripts": [` +
+		scriptJSON("9001000010") + `, ` + scriptJSON("9001000011") + `]}]}
+		]}]
+	}`})
+	s.handle("/JP/Script/90/9001000010.txt", atlasResponse{http.StatusOK, testScript})
+
+	results, err := s.client().ParseFromAtlas(context.Background(), []string{"9001"}, IdTypeWar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	war := results[0]
+	if war.Name != "Test War" || war.Kind != KindWar || war.Count.Lines != 2 {
+		t.Errorf("got %s %q with %d lines", war.Kind, war.Name, war.Count.Lines)
+	}
+	// The script that isn't on the static host fails on its own
+	if len(war.Failed) != 1 || war.Failed[0].ScriptId != "9001000011" || !strings.Contains(war.Failed[0].Err.Error(), "404") {
+		t.Errorf("got failed scripts %v, want only 9001000011 with status 404", war.Failed)
+	}
+	script := war.Children[0].Children[0].Children[0]
+	if want := s.URL + "/JP/Script/90/9001000010.txt"; script.Source != want {
+		t.Errorf("got source %q, want it rewritten to %q", script.Source, want)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		want     string
+		attempts int
+	}{
+		{"not found", http.StatusNotFound, "Make sure the ID is correct", 1},
+		{"bad request", http.StatusBadRequest, "Unexpected status 400", 1},
+		{"server error", http.StatusInternalServerError, "Unexpected status 500", DefaultRetries + 1},
+		{"too many requests", http.StatusTooManyRequests, "Unexpected status 429", DefaultRetries + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAtlasServer(t)
+			for _, path := range []string{"/nice/JP/war/9001", "/nice/JP/quest/9001", "/JP/Script/90/9001000010.txt"} {
+				s.handle(path, atlasResponse{tt.status, "{}"})
+			}
+			c := s.client()
+			ctx := context.Background()
+
+			_, _, warErr := c.FetchWarScripts(ctx, "9001")
+			_, _, questErr := c.FetchQuestScripts(ctx, "9001")
+			_, scriptErr := c.FetchSingleScript(ctx, "9001000010")
+			for path, err := range map[string]error{
+				"/nice/JP/war/9001":            warErr,
+				"/nice/JP/quest/9001":          questErr,
+				"/JP/Script/90/9001000010.txt": scriptErr,
+			} {
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("%s: got error %v, want it to contain %q", path, err, tt.want)
+				}
+				if n := s.requestCount(path); n != tt.attempts {
+					t.Errorf("%s: got %d requests, want %d", path, n, tt.attempts)
+				}
+			}
+		})
+	}
+}
+
+func TestParseScriptsMarksFailed(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/JP/Script/90/9001000010.txt", atlasResponse{http.StatusOK, testScript})
+	s.handle("/JP/Script/90/9001000020.txt", atlasResponse{http.StatusInternalServerError, ""})
+	script := func(id string, quest, phase int) Script {
+		return Script{ScriptId: id, Script: fmt.Sprintf("%s/JP/Script/90/%s.txt", s.URL, id), QuestId: quest, QuestName: "Quest", Phase: phase}
+	}
+	scripts := []Script{script("9001000030", 1, 2), script("9001000010", 1, 1), script("9001000020", 1, 1)}
+
+	result, err := s.client().ParseScripts(context.Background(), scripts, "Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The scripts that failed are sorted by ID, and the rest are still counted
+	if !result.Incomplete() || len(result.Failed) != 2 || result.Failed[0].ScriptId != "9001000020" || result.Failed[1].ScriptId != "9001000030" {
+		t.Errorf("got failed scripts %v, want 9001000020 and 9001000030", result.Failed)
+	}
+	if result.Count.Lines != 2 {
+		t.Errorf("got %d lines, want the script that was fetched counted", result.Count.Lines)
+	}
+	if n := s.requestCount("/JP/Script/90/9001000020.txt"); n != DefaultRetries+1 {
+		t.Errorf("got %d requests for the server error, want it retried %d times", n, DefaultRetries)
+	}
+	if n := s.requestCount("/JP/Script/90/9001000030.txt"); n != 1 {
+		t.Errorf("got %d requests for the missing script, want it not retried", n)
+	}
+
+	// Every level above a failed script is marked, and the rest aren't.
+	// Phases are in the order they were listed
+	quest := result.Children[0]
+	phase2, phase1 := quest.Children[0], quest.Children[1]
+	if !quest.Incomplete() || len(quest.Failed) != 2 {
+		t.Errorf("got quest failed scripts %v, want both", quest.Failed)
+	}
+	if !phase1.Incomplete() || !phase2.Incomplete() || phase1.Children[0].Incomplete() {
+		t.Errorf("got phases incomplete %t and %t, and the fetched script %t", phase1.Incomplete(), phase2.Incomplete(), phase1.Children[0].Incomplete())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/JP/Script/90/9001000010.txt",
+		atlasResponse{http.StatusTooManyRequests, ""},
+		atlasResponse{http.StatusServiceUnavailable, ""},
+		atlasResponse{http.StatusOK, testScript},
+	)
+	c := s.client()
+	c.RetryDelay = 20 * time.Millisecond
+
+	start := time.Now()
+	result, err := c.FetchSingleScript(context.Background(), "9001000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count.Lines != 2 {
+		t.Errorf("got %d lines, want 2", result.Count.Lines)
+	}
+	if n := s.requestCount("/JP/Script/90/9001000010.txt"); n != 3 {
+		t.Errorf("got %d requests, want 3", n)
+	}
+	// Waits the delay, then twice the delay
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("retried after %s, want the delay to double", elapsed)
+	}
+}
+
+func TestRetryCancelled(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/JP/Script/90/9001000010.txt", atlasResponse{http.StatusServiceUnavailable, ""})
+	c := s.client()
+	c.RetryDelay = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.FetchSingleScript(ctx, "9001000010"); err == nil {
+		t.Fatal("got no error for a cancelled retry")
+	}
+	if n := s.requestCount("/JP/Script/90/9001000010.txt"); n != 1 {
+		t.Errorf("got %d requests, want 1", n)
+	}
+}
+
+func TestParseFromAtlasCancelled(t *testing.T) {
+	// The script of quest 9002 never arrives, so the run only ends when it is cancelled
+	fetched := make(chan struct{})
+	fetching := sync.OnceFunc(func() { close(fetched) })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nice/JP/quest/9001", "/nice/JP/quest/9002":
+			id := strings.TrimPrefix(r.URL.Path, "/nice/JP/quest/")
+			fmt.Fprintf(w, `{"id": %s, "name": "Quest %s", "phaseScripts": [{"phase": 1, "scripts": [%s]}]}`, id, id, scriptJSON(id+"000010"))
+		case "/JP/Script/90/9001000010.txt":
+			fmt.Fprint(w, testScript)
+		default:
+			fetching()
+			<-r.Context().Done()
+		}
+	}))
+	defer server.Close()
+	c := NewClient(RegionJP)
+	c.APIURL, c.StaticURL, c.RateLimit = server.URL, server.URL, 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	type parsed struct {
+		results []ParseResult
+		err     error
+	}
+	done := make(chan parsed)
+	go func() {
+		results, err := c.ParseFromAtlas(ctx, []string{"9001", "9002"}, IdTypeQuest)
+		done <- parsed{results, err}
+	}()
+	<-fetched
+	// Give the other quest time to finish
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case p := <-done:
+		if !errors.Is(p.err, context.Canceled) {
+			t.Errorf("got error %v, want context.Canceled", p.err)
+		}
+		if len(p.results) != 1 || p.results[0].Id != "9001" {
+			t.Errorf("got results %+v, want only the quest completed before cancelling", p.results)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("parsing didn't stop after it was cancelled")
+	}
+}
+
+func TestFetchSource(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/JP/Script/90/9001000010.txt", atlasResponse{http.StatusOK, testScript})
+	c := s.client()
+	ctx := context.Background()
+
+	result, err := c.FetchSingleScript(ctx, "9001000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source, err := c.FetchSource(ctx, result); err != nil || source != testScript {
+		t.Errorf("got source %q and error %v for an Atlas script", source, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "0100000010.txt")
+	if err := os.WriteFile(path, []byte(testScript), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file := ParseResult{Kind: KindFile, Name: "0100000010", Source: path}
+	if source, err := c.FetchSource(ctx, file); err != nil || source != testScript {
+		t.Errorf("got source %q and error %v for a local file", source, err)
+	}
+
+	if _, err := c.FetchSource(ctx, ParseResult{Kind: KindWar, Name: "Fuyuki"}); err == nil {
+		t.Error("got no error for a result that isn't a single script")
+	}
+}
+
+func TestScriptURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		staticURL string
+		url       string
+		want      string
+	}{
+		{"public host", "", DefaultStaticURL + "/JP/Script/01/0100000111.txt", DefaultStaticURL + "/JP/Script/01/0100000111.txt"},
+		{"mirror", "http://mirror.test/", DefaultStaticURL + "/JP/Script/01/0100000111.txt", "http://mirror.test/JP/Script/01/0100000111.txt"},
+		{"other host", "http://mirror.test", "http://other.test/JP/Script/01/0100000111.txt", "http://other.test/JP/Script/01/0100000111.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{StaticURL: tt.staticURL}
+			if got := c.scriptURL(tt.url); got != tt.want {
+				t.Errorf("scriptURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScriptsWorkerPool(t *testing.T) {
+	const concurrency = 2
+	started := make(chan struct{}, 1000)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		fmt.Fprint(w, testScript)
+	}))
+	defer server.Close()
+
+	c := NewClient(RegionJP)
+	c.StaticURL, c.RateLimit, c.Concurrency = server.URL, 0, concurrency
+	var scripts []Script
+	for i := range 500 {
+		id := fmt.Sprintf("90010%05d", i)
+		scripts = append(scripts, Script{ScriptId: id, Script: fmt.Sprintf("%s/JP/Script/90/%s.txt", server.URL, id)})
+	}
+
+	before := runtime.NumGoroutine()
+	done := make(chan ParseResult)
+	go func() {
+		result, err := c.ParseScripts(context.Background(), scripts, "Test")
+		if err != nil {
+			t.Error(err)
+		}
+		done <- result
+	}()
+	for range concurrency {
+		<-started
+	}
+	// Give any extra workers time to start
+	time.Sleep(50 * time.Millisecond)
+	if n := runtime.NumGoroutine() - before; n > 50 {
+		t.Errorf("got %d more goroutines while fetching, want them limited by the concurrency", n)
+	}
+	if n := len(started); n > 0 {
+		t.Errorf("got %d requests over the concurrency limit", n)
+	}
+	close(release)
+
+	if result := <-done; result.Count.Lines != 2*len(scripts) {
+		t.Errorf("got %d lines, want %d", result.Count.Lines, 2*len(scripts))
+	}
+}
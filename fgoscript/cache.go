@@ -0,0 +1,185 @@
+package fgoscript
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-zoox/fetch"
+)
+
+// ErrNotCached is returned in offline mode for URLs that aren't in the cache
+var ErrNotCached = errors.New("not cached")
+
+// Cache stores successful responses on disk, keyed by URL.
+// Expired responses are revalidated with their ETag or Last-Modified header.
+type Cache struct {
+	Dir string
+	// How long a cached response is used before it is revalidated. Zero always revalidates
+	TTL time.Duration
+	// Only use cached responses, without making any requests
+	Offline bool
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// CacheStats is the number of requests served from and missing from the cache
+type CacheStats struct {
+	Hits   int
+	Misses int
+}
+
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	// Length of the body, to tell a body cut short by an interrupted write from a complete one
+	Size int `json:"size"`
+}
+
+// DefaultCacheDir returns the cache directory in the user cache directory
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fgo-script-parser")
+}
+
+// NewCache returns a cache stored in dir
+func NewCache(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl}
+}
+
+// Stats returns the hits and misses since the cache was created
+func (c *Cache) Stats() CacheStats {
+	return CacheStats{
+		Hits:   int(c.hits.Load()),
+		Misses: int(c.misses.Load()),
+	}
+}
+
+// Clear removes every cached response
+func (c *Cache) Clear() error {
+	err := os.RemoveAll(c.Dir)
+	if err != nil {
+		return fmt.Errorf("could not clear cache %s. %w", c.Dir, err)
+	}
+	return nil
+}
+
+// requestFunc makes a GET request with the given headers
+type requestFunc func(ctx context.Context, url string, headers fetch.Headers) (*fetch.Response, error)
+
+// get returns the response for url from the cache if possible, or else makes the request
+func (c *Cache) get(ctx context.Context, url string, request requestFunc) (*fetch.Response, error) {
+	entry, body, cached := c.load(url)
+	if cached && (c.Offline || time.Since(entry.FetchedAt) < c.TTL) {
+		c.hits.Add(1)
+		return &fetch.Response{Status: http.StatusOK, Body: body}, nil
+	}
+	if c.Offline {
+		c.misses.Add(1)
+		return nil, fmt.Errorf("%s is %w", url, ErrNotCached)
+	}
+
+	headers := fetch.Headers{}
+	if cached && entry.ETag != "" {
+		headers["If-None-Match"] = entry.ETag
+	}
+	if cached && entry.LastModified != "" {
+		headers["If-Modified-Since"] = entry.LastModified
+	}
+	response, err := request(ctx, url, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case response.Status == http.StatusNotModified && cached:
+		c.hits.Add(1)
+		entry.FetchedAt = time.Now()
+		c.store(entry, nil)
+		return &fetch.Response{Status: http.StatusOK, Headers: response.Headers, Body: body}, nil
+	case response.Status == http.StatusOK:
+		c.misses.Add(1)
+		c.store(cacheEntry{
+			URL:          url,
+			ETag:         response.Headers.Get("ETag"),
+			LastModified: response.Headers.Get("Last-Modified"),
+			FetchedAt:    time.Now(),
+			Size:         len(response.Body),
+		}, response.Body)
+	}
+	return response, nil
+}
+
+// path returns the path of the cache files for url, without extension
+func (c *Cache) path(url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(hash[:]))
+}
+
+func (c *Cache) load(url string) (cacheEntry, []byte, bool) {
+	var entry cacheEntry
+	path := c.path(url)
+	data, err := os.ReadFile(path + ".json")
+	if err != nil || json.Unmarshal(data, &entry) != nil || entry.URL != url {
+		return entry, nil, false
+	}
+	body, err := os.ReadFile(path + ".body")
+	if err != nil || len(body) != entry.Size {
+		return entry, nil, false
+	}
+	return entry, body, true
+}
+
+// store writes the entry and, if not nil, the body to disk. The body is written
+// first and the entry last, each to a temporary file that is then renamed, so
+// an interrupted or concurrent write never leaves an entry for a partial body.
+// Failing to write is not an error, the response just won't be cached.
+func (c *Cache) store(entry cacheEntry, body []byte) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return
+	}
+	path := c.path(entry.URL)
+	if body != nil {
+		if err := c.writeFile(path+".body", body); err != nil {
+			return
+		}
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	c.writeFile(path+".json", data)
+}
+
+// writeFile replaces the file at path with data through a temporary file in the cache directory
+func (c *Cache) writeFile(path string, data []byte) error {
+	file, err := os.CreateTemp(c.Dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package fgoscript
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheIgnoresPartialBody(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/JP/Script/90/9001000010.txt", atlasResponse{http.StatusOK, testScript})
+	c := s.client()
+	c.Cache = NewCache(t.TempDir(), time.Hour)
+	ctx := context.Background()
+
+	if _, err := c.FetchSingleScript(ctx, "9001000010"); err != nil {
+		t.Fatal(err)
+	}
+	// A write cut short leaves a body shorter than its entry says
+	url := s.URL + "/JP/Script/90/9001000010.txt"
+	if err := os.WriteFile(c.Cache.path(url)+".body", []byte(testScript[:5]), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Cache.Offline = true
+	if _, err := c.FetchSingleScript(ctx, "9001000010"); err == nil {
+		t.Error("got the partial body from the cache while offline")
+	}
+	c.Cache.Offline = false
+	result, err := c.FetchSingleScript(ctx, "9001000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count.Lines != 2 || s.requestCount("/JP/Script/90/9001000010.txt") != 2 {
+		t.Errorf("got %d lines after %d requests, want the script fetched again", result.Count.Lines, s.requestCount("/JP/Script/90/9001000010.txt"))
+	}
+
+	// Only the entry and body are left, without any temporary files
+	files, err := filepath.Glob(filepath.Join(c.Cache.Dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got cache files %v, want an entry and a body", files)
+	}
+}
+
+// cacheServer serves a script with an ETag or Last-Modified header, answering
+// matching conditional requests with 304 Not Modified
+type cacheServer struct {
+	*httptest.Server
+	requests    atomic.Int64
+	conditional atomic.Int64
+}
+
+func newCacheServer(t *testing.T, etag, lastModified string) *cacheServer {
+	s := &cacheServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		if lastModified != "" {
+			w.Header().Set("Last-Modified", lastModified)
+		}
+		if (etag != "" && r.Header.Get("If-None-Match") == etag) || (lastModified != "" && r.Header.Get("If-Modified-Since") == lastModified) {
+			s.conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, testScript)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *cacheServer) client(t *testing.T, ttl time.Duration) *Client {
+	c := NewClient(RegionJP)
+	c.StaticURL, c.RateLimit = s.URL, 0
+	c.Cache = NewCache(t.TempDir(), ttl)
+	return c
+}
+
+func TestCacheFresh(t *testing.T) {
+	s := newCacheServer(t, `"v1"`, "")
+	c := s.client(t, time.Hour)
+	for range 2 {
+		if _, err := c.FetchSingleScript(context.Background(), "9001000010"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want the second fetch served from the cache", n)
+	}
+	if stats := c.Cache.Stats(); stats != (CacheStats{Hits: 1, Misses: 1}) {
+		t.Errorf("got %+v, want a hit and a miss", stats)
+	}
+}
+
+func TestCacheRevalidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		etag         string
+		lastModified string
+	}{
+		{"etag", `"v1"`, ""},
+		{"last modified", "", "Wed, 01 Jan 2025 00:00:00 GMT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newCacheServer(t, tt.etag, tt.lastModified)
+			// Every cached response has expired straight away
+			c := s.client(t, 0)
+			for range 2 {
+				result, err := c.FetchSingleScript(context.Background(), "9001000010")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Count.Lines != 2 {
+					t.Errorf("got %d lines, want 2", result.Count.Lines)
+				}
+			}
+			if s.requests.Load() != 2 || s.conditional.Load() != 1 {
+				t.Errorf("got %d requests with %d conditional, want the second one conditional", s.requests.Load(), s.conditional.Load())
+			}
+			if stats := c.Cache.Stats(); stats != (CacheStats{Hits: 1, Misses: 1}) {
+				t.Errorf("got %+v, want the 304 counted as a hit", stats)
+			}
+		})
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	s := newCacheServer(t, "", "")
+	c := s.client(t, 0)
+	ctx := context.Background()
+	if _, err := c.FetchSingleScript(ctx, "9001000010"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Cache.Offline = true
+	// Expired responses are still used offline
+	if _, err := c.FetchSingleScript(ctx, "9001000010"); err != nil {
+		t.Errorf("got error %v for a cached script while offline", err)
+	}
+	_, err := c.FetchSingleScript(ctx, "9001000020")
+	if !errors.Is(err, ErrNotCached) {
+		t.Errorf("got error %v for a script that isn't cached, want ErrNotCached", err)
+	}
+	if n := s.requests.Load(); n != 1 {
+		t.Errorf("got %d requests, want none while offline", n)
+	}
+	if stats := c.Cache.Stats(); stats != (CacheStats{Hits: 1, Misses: 2}) {
+		t.Errorf("got %+v, want the offline miss counted", stats)
+	}
+}
@@ -0,0 +1,108 @@
+package fgoscript
+
+import (
+	"cmp"
+	"slices"
+)
+
+const (
+	// Speaker bucket for speaker blocks without a name
+	NarrationSpeaker = "(Narration)"
+	// Speaker bucket for player choices
+	ChoiceSpeaker = "(Choices)"
+)
+
+// CountMode decides how the text of a script is counted
+type CountMode int
+
+const (
+	// Count characters only. Used for languages that aren't separated by spaces
+	CountCharacters CountMode = iota
+	// Count space separated words as well as characters
+	CountWords
+)
+
+// Count is the number of dialogue lines and characters in one or more scripts
+type Count struct {
+	Lines      int `json:"lines"`
+	Characters int `json:"characters"`
+	// Counted words. Only set when counting with CountWords
+	Words int `json:"words,omitempty"`
+	// Lines and characters per speaker name. Always nil for the counts inside it
+	Speakers map[string]Count `json:"speakers,omitempty"`
+}
+
+// SpeakerCount is the count for a single speaker
+type SpeakerCount struct {
+	Name string
+	Count
+}
+
+// Add returns the sum of c and o, including the per-speaker counts
+func (c Count) Add(o Count) Count {
+	sum := Count{
+		Lines:      c.Lines + o.Lines,
+		Characters: c.Characters + o.Characters,
+		Words:      c.Words + o.Words,
+	}
+	if len(c.Speakers) > 0 || len(o.Speakers) > 0 {
+		sum.Speakers = make(map[string]Count, max(len(c.Speakers), len(o.Speakers)))
+		for name, s := range c.Speakers {
+			sum.Speakers[name] = sum.Speakers[name].Add(s)
+		}
+		for name, s := range o.Speakers {
+			sum.Speakers[name] = sum.Speakers[name].Add(s)
+		}
+	}
+	return sum
+}
+
+// WordCount returns the counted words if there are any. Otherwise it returns
+// the approximate English word count, which is conventionally half the character count.
+func (c Count) WordCount() int {
+	if c.Words > 0 {
+		return c.Words
+	}
+	return c.Characters / 2
+}
+
+// SortedSpeakers returns the per-speaker counts, most characters first
+func (c Count) SortedSpeakers() []SpeakerCount {
+	speakers := make([]SpeakerCount, 0, len(c.Speakers))
+	for name, s := range c.Speakers {
+		speakers = append(speakers, SpeakerCount{Name: name, Count: s})
+	}
+	slices.SortFunc(speakers, func(a, b SpeakerCount) int {
+		if a.Characters != b.Characters {
+			return cmp.Compare(b.Characters, a.Characters)
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return speakers
+}
+
+// addLine adds a single line with the given count to the total and the speaker's count
+func (c *Count) addLine(speaker string, characters, words int) {
+	c.Lines++
+	c.Characters += characters
+	c.Words += words
+
+	if c.Speakers == nil {
+		c.Speakers = make(map[string]Count)
+	}
+	s := c.Speakers[speaker]
+	s.Lines++
+	s.Characters += characters
+	s.Words += words
+	c.Speakers[speaker] = s
+}
+
+// CleanAndCountScript counts the dialogue lines and characters in the contents of a script file
+func CleanAndCountScript(data string) Count {
+	return ParseScript(data).Count(CountCharacters)
+}
+
+// CountScript counts the contents of a script file using the given mode
+func CountScript(data string, mode CountMode) Count {
+	return ParseScript(data).Count(mode)
+}
@@ -0,0 +1,57 @@
+package fgoscript
+
+import "strings"
+
+// DialogueLine is the text of a single counted dialogue line or choice, with its tags stripped
+type DialogueLine struct {
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+}
+
+// Dialogue returns the text of every line counted by Count, in script order.
+// The lines of a speaker block are joined with spaces, ruby is written as
+// base(reading) and gender tags as male/female
+func (d *Document) Dialogue() []DialogueLine {
+	var dialogue []DialogueLine
+	for _, n := range d.Nodes {
+		switch n := n.(type) {
+		case *SpeakerBlock:
+			if !n.Closed {
+				continue
+			}
+			var lines []string
+			for _, l := range n.Lines {
+				if text := l.text(); text != "" {
+					lines = append(lines, text)
+				}
+			}
+			dialogue = append(dialogue, DialogueLine{Speaker: n.speaker(), Text: strings.Join(lines, " ")})
+		case *Choice:
+			dialogue = append(dialogue, DialogueLine{Speaker: ChoiceSpeaker, Text: n.Text.text()})
+		}
+	}
+	return dialogue
+}
+
+// ScriptDialogue returns the counted dialogue lines in the contents of a script file
+func ScriptDialogue(data string) []DialogueLine {
+	return ParseScript(data).Dialogue()
+}
+
+func (l *TextLine) text() string {
+	var sb strings.Builder
+	for _, i := range l.Inlines {
+		switch i := i.(type) {
+		case *Text:
+			sb.WriteString(i.Value)
+		case *Ruby:
+			sb.WriteString(i.Base)
+			if i.Reading != "" {
+				sb.WriteString("(" + i.Reading + ")")
+			}
+		case *Gender:
+			sb.WriteString(i.Male + "/" + i.Female)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
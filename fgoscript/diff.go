@@ -0,0 +1,172 @@
+package fgoscript
+
+// Change is how an item differs between two sets of results
+type Change string
+
+const (
+	Unchanged Change = "unchanged"
+	Added     Change = "added"
+	Removed   Change = "removed"
+	Changed   Change = "changed"
+)
+
+// ResultDiff is the difference between an item in two sets of results
+type ResultDiff struct {
+	Change Change     `json:"change"`
+	Kind   ResultKind `json:"kind"`
+	Id     string     `json:"id"`
+	Name   string     `json:"name"`
+	// Count in each set. Old is zero for added items and New for removed ones
+	Old Count `json:"old"`
+	New Count `json:"new"`
+	// Dialogue lines added or removed, in script order. Only set for scripts
+	// and files that have their dialogue in both sets
+	Dialogue []DialogueEdit `json:"dialogue,omitempty"`
+	Children []ResultDiff   `json:"children,omitempty"`
+}
+
+// Delta returns the new count minus the old count, without speakers
+func (d ResultDiff) Delta() Count {
+	return Count{
+		Lines:      d.New.Lines - d.Old.Lines,
+		Characters: d.New.Characters - d.Old.Characters,
+		Words:      d.New.Words - d.Old.Words,
+	}
+}
+
+// DialogueEdit is a dialogue line that was added or removed
+type DialogueEdit struct {
+	// Added or Removed
+	Change Change `json:"change"`
+	DialogueLine
+}
+
+// DiffResults compares two sets of results, matching items by kind and ID, or
+// by name for items without an ID such as local files. Items are listed in the
+// order of the new set, followed by the removed items in their old order
+func DiffResults(old, new []ParseResult) []ResultDiff {
+	// Items that share a key, such as files with the same name, are matched in order
+	oldByKey := make(map[string][]int, len(old))
+	for i, r := range old {
+		key := diffKey(r)
+		oldByKey[key] = append(oldByKey[key], i)
+	}
+
+	var diffs []ResultDiff
+	matched := make([]bool, len(old))
+	for _, n := range new {
+		key := diffKey(n)
+		indexes := oldByKey[key]
+		if len(indexes) == 0 {
+			diffs = append(diffs, addedDiff(Added, n))
+			continue
+		}
+		oldByKey[key] = indexes[1:]
+		matched[indexes[0]] = true
+		diffs = append(diffs, diffResult(old[indexes[0]], n))
+	}
+	for i, o := range old {
+		if !matched[i] {
+			diffs = append(diffs, addedDiff(Removed, o))
+		}
+	}
+	return diffs
+}
+
+// diffKey identifies an item across two sets of results
+func diffKey(r ParseResult) string {
+	if r.Id != "" {
+		return string(r.Kind) + "/" + r.Id
+	}
+	return string(r.Kind) + "/" + r.Name
+}
+
+func diffResult(old, new ParseResult) ResultDiff {
+	diff := ResultDiff{
+		Change:   Unchanged,
+		Kind:     new.Kind,
+		Id:       new.Id,
+		Name:     new.Name,
+		Old:      old.Count,
+		New:      new.Count,
+		Children: DiffResults(old.Children, new.Children),
+	}
+	if old.Dialogue != nil && new.Dialogue != nil {
+		diff.Dialogue = DiffDialogue(old.Dialogue, new.Dialogue)
+	}
+
+	delta := diff.Delta()
+	if delta.Lines != 0 || delta.Characters != 0 || delta.Words != 0 || len(diff.Dialogue) > 0 {
+		diff.Change = Changed
+	}
+	for _, child := range diff.Children {
+		if child.Change != Unchanged {
+			diff.Change = Changed
+		}
+	}
+	return diff
+}
+
+// addedDiff returns the diff of an item, and all of its children, that is only in one set
+func addedDiff(change Change, r ParseResult) ResultDiff {
+	diff := ResultDiff{Change: change, Kind: r.Kind, Id: r.Id, Name: r.Name}
+	if change == Added {
+		diff.New = r.Count
+	} else {
+		diff.Old = r.Count
+	}
+	for _, child := range r.Children {
+		diff.Children = append(diff.Children, addedDiff(change, child))
+	}
+	return diff
+}
+
+// DiffDialogue returns the dialogue lines removed from old and added in new,
+// in script order, using the longest common subsequence of the two
+func DiffDialogue(old, new []DialogueLine) []DialogueEdit {
+	// Most edits are small, so skip the common start and end before comparing the rest
+	for len(old) > 0 && len(new) > 0 && old[0] == new[0] {
+		old, new = old[1:], new[1:]
+	}
+	for len(old) > 0 && len(new) > 0 && old[len(old)-1] == new[len(new)-1] {
+		old, new = old[:len(old)-1], new[:len(new)-1]
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of old[i:] and new[j:]
+	lcs := make([][]int, len(old)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if old[i] == new[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []DialogueEdit
+	i, j := 0, 0
+	for i < len(old) && j < len(new) {
+		switch {
+		case old[i] == new[j]:
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, DialogueEdit{Removed, old[i]})
+			i++
+		default:
+			edits = append(edits, DialogueEdit{Added, new[j]})
+			j++
+		}
+	}
+	for ; i < len(old); i++ {
+		edits = append(edits, DialogueEdit{Removed, old[i]})
+	}
+	for ; j < len(new); j++ {
+		edits = append(edits, DialogueEdit{Added, new[j]})
+	}
+	return edits
+}
@@ -0,0 +1,39 @@
+package fgoscript
+
+import "testing"
+
+func TestDiffResultsSharedKeys(t *testing.T) {
+	file := func(name string, lines int) ParseResult {
+		return ParseResult{Kind: KindFile, Name: name, Count: Count{Lines: lines}}
+	}
+
+	tests := []struct {
+		name string
+		old  []ParseResult
+		new  []ParseResult
+		want []Change
+	}{
+		{"two old with one new", []ParseResult{file("a", 1), file("a", 2)}, []ParseResult{file("a", 1)}, []Change{Unchanged, Removed}},
+		{"one old with two new", []ParseResult{file("a", 1)}, []ParseResult{file("a", 1), file("a", 2)}, []Change{Unchanged, Added}},
+		{"matched in order", []ParseResult{file("a", 1), file("a", 2)}, []ParseResult{file("a", 1), file("a", 3)}, []Change{Unchanged, Changed}},
+		{"different keys", []ParseResult{file("a", 1)}, []ParseResult{file("b", 1)}, []Change{Added, Removed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := DiffResults(tt.old, tt.new)
+			var got []Change
+			for _, d := range diffs {
+				got = append(got, d.Change)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got changes %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got changes %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+// Package fgoscript counts the dialogue lines and characters of FGO story scripts.
+//
+// Scripts can either be fetched from Atlas DB (by war, quest or script ID) or
+// read from local files and directories, using a Client for the scripts'
+// region. The counting itself is done by CountScript, which can also be used
+// directly on a script's contents.
+package fgoscript
@@ -0,0 +1,114 @@
+package fgoscript
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strings"
+)
+
+// Duplicate is a script left out of a count because a script with the same
+// contents was counted before it, such as a script that redirects to another
+type Duplicate struct {
+	// Atlas script ID, or file path for local scripts
+	ScriptId string `json:"scriptId"`
+	// Script with the same contents that was counted instead
+	DuplicateOf string `json:"duplicateOf"`
+	// Count that was left out, without speakers
+	Count Count `json:"count"`
+}
+
+// hashScript returns the hash of the contents of a script, ignoring line endings
+// and surrounding whitespace, so copies saved on different systems still match
+func hashScript(data string) string {
+	data = strings.TrimPrefix(data, "\ufeff")
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	sum := sha256.Sum256([]byte(strings.TrimSpace(data)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ExcludeDuplicates returns the results with every script that has the same contents
+// as a script before it, anywhere in the results, left out of the counts. The scripts
+// left out are listed in the Duplicates of every result they were in. Scripts without
+// any dialogue are never left out, and neither are the top level results themselves:
+// a top level script that is a duplicate is kept with an empty count
+func ExcludeDuplicates(results []ParseResult) []ParseResult {
+	seen := make(map[string]string)
+	excluded := make([]ParseResult, len(results))
+	for i, r := range results {
+		excluded[i], _ = excludeDuplicates(r, seen, true)
+	}
+	return excluded
+}
+
+// excludeDuplicates leaves the duplicates out of a result and its children, and
+// reports whether the result is still kept. A result that isn't kept only has the
+// duplicates it was made up of
+func excludeDuplicates(r ParseResult, seen map[string]string, top bool) (ParseResult, bool) {
+	if len(r.Children) == 0 {
+		if r.Hash == "" || r.Count.Lines == 0 {
+			return r, true
+		}
+		first, found := seen[r.Hash]
+		if !found {
+			seen[r.Hash] = scriptRef(r)
+			return r, true
+		}
+		duplicate := &Duplicate{
+			ScriptId:    scriptRef(r),
+			DuplicateOf: first,
+			Count:       Count{Lines: r.Count.Lines, Characters: r.Count.Characters, Words: r.Count.Words},
+		}
+		if top {
+			return ParseResult{Id: r.Id, Name: r.Name, Kind: r.Kind, Source: r.Source, Hash: r.Hash, Duplicates: []*Duplicate{duplicate}}, true
+		}
+		return ParseResult{Duplicates: []*Duplicate{duplicate}}, false
+	}
+
+	changed := false
+	var children []ParseResult
+	var removed []*Duplicate
+	for _, child := range r.Children {
+		kept, keep := excludeDuplicates(child, seen, false)
+		if len(kept.Duplicates) > len(child.Duplicates) || !keep {
+			changed = true
+		}
+		if !keep {
+			removed = append(removed, kept.Duplicates...)
+			continue
+		}
+		children = append(children, kept)
+	}
+	if !changed {
+		return r, true
+	}
+
+	// Keep everything else about the result, such as its arc and source
+	parent := newParentResult(r.Kind, r.Id, r.Name, children)
+	result := r
+	result.Children, result.Count, result.Failed = children, parent.Count, parent.Failed
+	result.Duplicates = append(parent.Duplicates, removed...)
+	slices.SortFunc(result.Failed, func(a, b *ScriptError) int {
+		return strings.Compare(a.ScriptId, b.ScriptId)
+	})
+	if len(children) == 0 && !top {
+		return ParseResult{Duplicates: result.Duplicates}, false
+	}
+	return result, true
+}
+
+// scriptRef returns how a script is referred to: its Atlas ID, or its path for local files
+func scriptRef(r ParseResult) string {
+	if r.Id != "" {
+		return r.Id
+	}
+	return r.Source
+}
+
+// excludeDuplicates leaves the duplicates out of the results unless the client keeps them
+func (c *Client) excludeDuplicates(results []ParseResult) []ParseResult {
+	if c.KeepDuplicates || len(results) == 0 {
+		return results
+	}
+	return ExcludeDuplicates(results)
+}
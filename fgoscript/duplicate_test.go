@@ -0,0 +1,40 @@
+package fgoscript
+
+import "testing"
+
+func TestExcludeDuplicates(t *testing.T) {
+	script := func(id, data string) ParseResult {
+		c := &Client{}
+		r := c.scriptResult(data)
+		r.Id, r.Name, r.Kind = id, id, KindScript
+		return r
+	}
+	first := script("0100000010", "＠A：マシュ\nはい\n[k]\n")
+	copied := script("0100000020", "＠A：マシュ\r\nはい\r\n[k]\r\n")
+	other := script("0100000030", "＠A：マシュ\nいいえ\n[k]\n")
+	empty := script("0100000040", "[end]")
+	emptyCopy := script("0100000050", "[end]")
+
+	war := newParentResult(KindWar, "100", "Fuyuki", []ParseResult{first, copied, other, empty, emptyCopy})
+	war.Arc = "Part 1"
+	war.Source = "war source"
+
+	results := ExcludeDuplicates([]ParseResult{war, script("0100000060", "＠A：マシュ\nはい\n[k]\n")})
+
+	got := results[0]
+	if got.Arc != "Part 1" || got.Source != "war source" || got.Id != "100" || got.Kind != KindWar {
+		t.Errorf("got %+v, want the war's fields kept", got)
+	}
+	if got.Count.Lines != 2 || len(got.Children) != 4 {
+		t.Errorf("got %d lines in %d children, want 2 lines in 4", got.Count.Lines, len(got.Children))
+	}
+	if len(got.Duplicates) != 1 || got.Duplicates[0].ScriptId != "0100000020" || got.Duplicates[0].DuplicateOf != "0100000010" {
+		t.Errorf("got duplicates %+v, want 0100000020 as a duplicate of 0100000010", got.Duplicates)
+	}
+
+	// A top level duplicate is kept with an empty count
+	top := results[1]
+	if top.Id != "0100000060" || top.Count.Lines != 0 || len(top.Duplicates) != 1 {
+		t.Errorf("got %+v, want an empty result listing itself as a duplicate", top)
+	}
+}
@@ -0,0 +1,83 @@
+package fgoscript
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// basicWar is a war in the Atlas war export
+type basicWar struct {
+	Id      int `json:"id"`
+	EventId int `json:"eventId"`
+}
+
+// basicEvent is an event in the Atlas event export
+type basicEvent struct {
+	Id        int   `json:"id"`
+	StartedAt int64 `json:"startedAt"`
+}
+
+// FetchEventWars returns the IDs of the wars of every event by the year the event started
+// in, in the region's time zone. The wars of a year are ordered by when their events started
+func (c *Client) FetchEventWars(ctx context.Context) (map[int][]string, error) {
+	var wars []basicWar
+	if err := c.fetchExport(ctx, "basic_war", &wars); err != nil {
+		return nil, err
+	}
+	var events []basicEvent
+	if err := c.fetchExport(ctx, "basic_event", &events); err != nil {
+		return nil, err
+	}
+
+	started := make(map[int]time.Time, len(events))
+	for _, e := range events {
+		started[e.Id] = time.Unix(e.StartedAt, 0).In(c.Region.location())
+	}
+	var eventWars []basicWar
+	for _, w := range wars {
+		if _, found := started[w.EventId]; found && w.EventId != 0 {
+			eventWars = append(eventWars, w)
+		}
+	}
+	slices.SortFunc(eventWars, func(a, b basicWar) int {
+		return cmp.Or(started[a.EventId].Compare(started[b.EventId]), cmp.Compare(a.Id, b.Id))
+	})
+
+	byYear := make(map[int][]string)
+	for _, w := range eventWars {
+		year := started[w.EventId].Year()
+		byYear[year] = append(byYear[year], strconv.Itoa(w.Id))
+	}
+	return byYear, nil
+}
+
+// fetchExport fetches an Atlas export file of the client's region, such as basic_war
+func (c *Client) fetchExport(ctx context.Context, name string, v any) error {
+	c.tracker().fetching("export", name)
+	response, err := c.get(ctx, fmt.Sprintf("%s/export/%s/%s.json", c.apiBase(), c.Region, name))
+	if err != nil {
+		return fmt.Errorf("could not get %s export. %w", name, err)
+	} else if response.StatusCode() != http.StatusOK {
+		return fmt.Errorf("could not get %s export. Unexpected status %d", name, response.StatusCode())
+	}
+	if err := response.UnmarshalJSON(v); err != nil {
+		return fmt.Errorf("error unmarshaling JSON: %w", err)
+	}
+	return nil
+}
+
+// location returns the time zone the region's events are scheduled in
+func (r Region) location() *time.Location {
+	switch r {
+	case RegionNA:
+		return time.FixedZone("PT", -7*60*60)
+	case RegionCN, RegionTW:
+		return time.FixedZone("CST", 8*60*60)
+	}
+	return time.FixedZone("JST", 9*60*60)
+}
@@ -0,0 +1,93 @@
+package fgoscript
+
+import "strings"
+
+type tokenType int
+
+const (
+	// Plain text between tags
+	tokenText tokenType = iota
+	// Contents of a [...] tag, without the brackets
+	tokenTag
+	// ＠ line, value is everything after the ＠
+	tokenSpeaker
+	// ？ line, value is the choice number. The choice text follows as text and tag tokens
+	tokenChoice
+	// ？！ line closing a set of choices
+	tokenChoiceEnd
+	tokenNewline
+	tokenEOF
+)
+
+type token struct {
+	typ   tokenType
+	value string
+	// 1-based line number in the script
+	line int
+}
+
+// lex splits a script into tokens. The script format is line based, so
+// speaker and choice markers are only recognised at the start of a line.
+func lex(data string) []token {
+	var tokens []token
+	for i, line := range strings.Split(data, "\n") {
+		n := i + 1
+		line = strings.TrimSuffix(line, "\r")
+
+		switch {
+		case strings.HasPrefix(line, "＠"):
+			tokens = append(tokens, token{typ: tokenSpeaker, value: strings.TrimPrefix(line, "＠"), line: n})
+		case strings.TrimSpace(line) == "？！":
+			tokens = append(tokens, token{typ: tokenChoiceEnd, line: n})
+		case strings.HasPrefix(line, "？") && strings.Contains(line, "："):
+			number, text, _ := strings.Cut(strings.TrimPrefix(line, "？"), "：")
+			tokens = append(tokens, token{typ: tokenChoice, value: number, line: n})
+			tokens = lexInline(tokens, text, n)
+		default:
+			tokens = lexInline(tokens, line, n)
+		}
+		tokens = append(tokens, token{typ: tokenNewline, line: n})
+	}
+
+	return append(tokens, token{typ: tokenEOF})
+}
+
+// lexInline appends the text and tag tokens of a single line to tokens
+func lexInline(tokens []token, line string, n int) []token {
+	for line != "" {
+		start := strings.IndexByte(line, '[')
+		if start < 0 {
+			return append(tokens, token{typ: tokenText, value: line, line: n})
+		}
+
+		end := matchingBracket(line, start)
+		// An unclosed bracket is just text
+		if end < 0 {
+			return append(tokens, token{typ: tokenText, value: line, line: n})
+		}
+
+		if start > 0 {
+			tokens = append(tokens, token{typ: tokenText, value: line[:start], line: n})
+		}
+		tokens = append(tokens, token{typ: tokenTag, value: line[start+1 : end], line: n})
+		line = line[end+1:]
+	}
+	return tokens
+}
+
+// matchingBracket returns the index of the ] closing the [ at start, or -1 if there is none
+func matchingBracket(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,41 @@
+package fgoscript
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter spaces out requests evenly to stay under a number of requests per second
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// Earliest time the next request may start
+	next time.Time
+}
+
+func newLimiter(perSecond float64) *limiter {
+	return &limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next request may start
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
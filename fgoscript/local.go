@@ -0,0 +1,150 @@
+package fgoscript
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ParseFromLocal counts the script files at each path using DefaultClient
+func ParseFromLocal(ctx context.Context, paths []string) ([]ParseResult, error) {
+	return DefaultClient.ParseFromLocal(ctx, paths)
+}
+
+// TraverseDirectories walks path using DefaultClient
+func TraverseDirectories(ctx context.Context, path string, results *[]ParseResult) error {
+	return DefaultClient.TraverseDirectories(ctx, path, results)
+}
+
+// ParseFromLocal counts the script files at each path, using the client region's count mode.
+// A path to a file gives one result for that file, while a path to a directory
+// gives one result per lowest level directory below it. If parsing stops early,
+// the results completed before that are returned along with the error.
+// Duplicate files are left out unless the client keeps them. Files are matched
+// to the client's rules by their name without the extension, e.g. 0100000111.txt.
+func (c *Client) ParseFromLocal(ctx context.Context, paths []string) ([]ParseResult, error) {
+	results, err := c.parseLocal(ctx, paths)
+	return c.excludeDuplicates(results), err
+}
+
+func (c *Client) parseLocal(ctx context.Context, paths []string) ([]ParseResult, error) {
+	var results []ParseResult
+
+	listed := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		listed[fileName(strings.Trim(path, "\""))] = true
+	}
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+		path = strings.Trim(path, "\"")
+		argInfo, err := os.Stat(path)
+		if err != nil {
+			return results, fmt.Errorf("could not get file info for %s. %w", path, err)
+		}
+
+		// If given path is a file, just open and count it, else traverse the directory
+		if argInfo.IsDir() {
+			err = c.TraverseDirectories(ctx, path, &results)
+			if err != nil {
+				return results, err
+			}
+		} else if !c.rules().skips(fileName(path), listed) {
+			script := Script{ScriptId: path}
+			c.tracker().addScripts([]Script{script})
+			c.tracker().fetching("file", path)
+			data, err := os.ReadFile(path)
+			c.tracker().scriptDone(script)
+			if err != nil {
+				return results, fmt.Errorf("can't read file: %s. %w", path, err)
+			}
+			result := c.scriptResult(string(data))
+			result.Name = fileName(path)
+			result.Kind = KindFile
+			result.Source = path
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// TraverseDirectories walks path and appends one result per lowest level directory to results.
+// Files that can't be read are listed in the result's Failed scripts. Directories matched
+// to a war in the war table get the war's ID and name, unless the client uses raw names.
+// Files left out by the client's rules are skipped, as are files next to other
+// directories, such as a README beside the chapter directories.
+func (c *Client) TraverseDirectories(ctx context.Context, path string, results *[]ParseResult) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("unable to get entries for directory %s. %w", path, err)
+	}
+
+	hasDirectory := slices.ContainsFunc(entries, func(e fs.DirEntry) bool {
+		return e.IsDir()
+	})
+
+	// If directories exist, call this recursively for each one until we hit the lowest level
+	if hasDirectory {
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			err = c.TraverseDirectories(ctx, filepath.Join(path, e.Name()), results)
+			if err != nil {
+				break
+			}
+		}
+		return err
+	}
+
+	listed := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		listed[fileName(e.Name())] = true
+	}
+	entries = slices.DeleteFunc(entries, func(e fs.DirEntry) bool {
+		return c.rules().skips(fileName(e.Name()), listed)
+	})
+
+	var files []ParseResult
+	c.tracker().addScripts(make([]Script, len(entries)))
+	// This could be done with goroutines but it's pretty fast already
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := filepath.Join(path, e.Name())
+		c.tracker().fetching("file", file)
+		data, err := os.ReadFile(file)
+		c.tracker().scriptDone(Script{ScriptId: file})
+		var result ParseResult
+		if err != nil {
+			result.Failed = []*ScriptError{{ScriptId: file, Err: err}}
+		} else {
+			result = c.scriptResult(string(data))
+		}
+		result.Name, result.Kind, result.Source = fileName(file), KindFile, file
+		files = append(files, result)
+	}
+	result := newParentResult(KindDirectory, "", filepath.Base(path), files)
+	if war, found := MatchWar(result.Name); found && c.Names != NamesRaw {
+		result.Id, result.Name, result.Arc = war.Id, war.Name(c.Names, result.Name), war.Arc
+	}
+	*results = append(*results, result)
+
+	return nil
+}
+
+// fileName returns the name of a script file without its extension
+func fileName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
@@ -0,0 +1,49 @@
+package fgoscript
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseFromLocalSkipsFilesBesideDirectories(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"README.md":                       "# Scripts",
+		".DS_Store":                       "",
+		"war_101/0100000010.txt":          "＠A：マシュ\n先輩！\n[k]\n",
+		"war_101/0100000020.txt":          "＠A：マシュ\nはい\n[k]\n",
+		"part2/notes.txt":                 "notes",
+		"part2/Lostbelt 1/0300000010.txt": "＠A：マシュ\nいいえ\n[k]\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewClient(RegionJP)
+	c.Names = NamesRaw
+	results, err := c.ParseFromLocal(context.Background(), []string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	lines := 0
+	for _, r := range results {
+		names = append(names, r.Name)
+		lines += r.Count.Lines
+	}
+	if want := []string{"Lostbelt 1", "war_101"}; !slices.Equal(names, want) {
+		t.Errorf("got directories %v, want %v", names, want)
+	}
+	if lines != 3 {
+		t.Errorf("got %d lines, want 3", lines)
+	}
+}
@@ -0,0 +1,135 @@
+package fgoscript
+
+import "strings"
+
+// ParseScript parses the contents of a script file into a Document
+func ParseScript(data string) *Document {
+	p := parser{tokens: lex(data)}
+	return p.parse()
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	doc    Document
+	// Speaker block waiting for its [k] page break
+	block *SpeakerBlock
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parse() *Document {
+	for {
+		t := p.next()
+		switch t.typ {
+		case tokenEOF:
+			p.endBlock()
+			return &p.doc
+		case tokenSpeaker:
+			p.endBlock()
+			slot, name := splitSpeaker(t.value)
+			p.block = &SpeakerBlock{Slot: slot, Name: name, Line: t.line}
+		case tokenChoice:
+			p.endBlock()
+			line, _ := p.parseLine(t.line)
+			p.doc.Nodes = append(p.doc.Nodes, &Choice{Number: t.value, Text: line})
+		case tokenChoiceEnd:
+			p.endBlock()
+			p.doc.Nodes = append(p.doc.Nodes, &ChoiceEnd{Line: t.line})
+		case tokenNewline:
+		default:
+			p.pos--
+			line, pageBreak := p.parseLine(t.line)
+			if p.block != nil {
+				if len(line.Inlines) > 0 {
+					p.block.Lines = append(p.block.Lines, line)
+				}
+				if pageBreak {
+					p.block.Closed = true
+					p.endBlock()
+				}
+				continue
+			}
+
+			if len(line.Inlines) > 0 {
+				p.doc.Nodes = append(p.doc.Nodes, line)
+			}
+			if pageBreak {
+				p.doc.Nodes = append(p.doc.Nodes, &PageBreak{Line: t.line})
+			}
+		}
+	}
+}
+
+// endBlock adds the current speaker block, if any, to the document
+func (p *parser) endBlock() {
+	if p.block == nil {
+		return
+	}
+	p.doc.Nodes = append(p.doc.Nodes, p.block)
+	p.block = nil
+}
+
+// parseLine reads text and tag tokens up to the end of the line. It also
+// reports whether the line contained a [k] page break, in which case anything
+// after it is dropped.
+func (p *parser) parseLine(n int) (*TextLine, bool) {
+	line := &TextLine{Line: n}
+	pageBreak := false
+	for {
+		t := p.tokens[p.pos]
+		if t.typ != tokenText && t.typ != tokenTag {
+			return line, pageBreak
+		}
+		p.pos++
+		if pageBreak {
+			continue
+		}
+
+		switch t.typ {
+		case tokenText:
+			line.Inlines = append(line.Inlines, &Text{Value: t.value})
+		case tokenTag:
+			if t.value == "k" {
+				pageBreak = true
+				continue
+			}
+			line.Inlines = append(line.Inlines, parseTag(t.value))
+		}
+	}
+}
+
+// parseTag turns the contents of a [...] tag into an inline element
+func parseTag(tag string) Inline {
+	switch {
+	case strings.HasPrefix(tag, "#"):
+		base, reading, _ := strings.Cut(tag[1:], ":")
+		return &Ruby{Base: base, Reading: reading}
+	case strings.HasPrefix(tag, "&"):
+		male, female, _ := strings.Cut(tag[1:], ":")
+		return &Gender{Male: male, Female: female}
+	}
+
+	fields := strings.Fields(tag)
+	if len(fields) == 0 {
+		return &FunctionTag{}
+	}
+	return &FunctionTag{Name: fields[0], Args: fields[1:]}
+}
+
+// splitSpeaker splits the contents of a ＠ line into the character slot and name
+func splitSpeaker(s string) (string, string) {
+	for _, sep := range []string{"：", ":"} {
+		slot, name, found := strings.Cut(s, sep)
+		if found && len(slot) == 1 && slot[0] >= 'A' && slot[0] <= 'Z' {
+			return slot, name
+		}
+	}
+	return "", s
+}
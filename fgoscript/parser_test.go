@@ -0,0 +1,286 @@
+package fgoscript
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestCountScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		mode     CountMode
+		want     Count
+		speakers map[string]Count
+	}{
+		{
+			name:     "speaker block over several lines",
+			script:   "＠A：マシュ\n一行目\n二行目\n三行目\n四行目\n[k]\n",
+			want:     Count{Lines: 1, Characters: 12},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 12}},
+		},
+		{
+			name:   "unclosed block",
+			script: "＠A：マシュ\nこんにちは\n",
+			want:   Count{},
+		},
+		{
+			name:     "unclosed block followed by a closed block",
+			script:   "＠A：マシュ\nあ\n＠B：フォウ\nフォウ\n[k]\n",
+			want:     Count{Lines: 1, Characters: 3},
+			speakers: map[string]Count{"フォウ": {Lines: 1, Characters: 3}},
+		},
+		{
+			name:     "page break in the middle of a line",
+			script:   "＠A：マシュ\nあい[k]うえ\n",
+			want:     Count{Lines: 1, Characters: 2},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 2}},
+		},
+		{
+			name:     "speaker without a slot",
+			script:   "＠マシュ\nはい\n[k]\n",
+			want:     Count{Lines: 1, Characters: 2},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 2}},
+		},
+		{
+			name:     "narration",
+			script:   "＠\n静かな夜。\n[k]\n",
+			want:     Count{Lines: 1, Characters: 5},
+			speakers: map[string]Count{NarrationSpeaker: {Lines: 1, Characters: 5}},
+		},
+		{
+			name:     "text outside of speaker blocks",
+			script:   "[scene 10000]\n地の文\n[k]\n",
+			want:     Count{},
+			speakers: nil,
+		},
+		{
+			name:     "choices",
+			script:   "？1：はい\n？2：いいえ\n？！\n",
+			want:     Count{Lines: 2, Characters: 5},
+			speakers: map[string]Count{ChoiceSpeaker: {Lines: 2, Characters: 5}},
+		},
+		{
+			name:     "ruby",
+			script:   "＠A：マシュ\n[#計画:コ　ト]です\n[k]\n",
+			want:     Count{Lines: 1, Characters: 7},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 7}},
+		},
+		{
+			name:     "emphasis",
+			script:   "＠A：マシュ\n[#強調]です\n[k]\n",
+			want:     Count{Lines: 1, Characters: 4},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 4}},
+		},
+		{
+			name:     "gender",
+			script:   "＠A：マシュ\n[&ああ:うん]\n[k]\n",
+			want:     Count{Lines: 1, Characters: 4},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 4}},
+		},
+		{
+			name:     "function tags",
+			script:   "＠A：マシュ\n[line 3]あ[r]い[image *]\n[k]\n",
+			want:     Count{Lines: 1, Characters: 2},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 2}},
+		},
+		{
+			name:     "CRLF line endings",
+			script:   "＠A：マシュ\r\nはい\r\n[k]\r\n",
+			want:     Count{Lines: 1, Characters: 2},
+			speakers: map[string]Count{"マシュ": {Lines: 1, Characters: 2}},
+		},
+		{
+			name:     "words",
+			script:   "＠A：Mash\nHello[r]there, [#Senpai]!\n[k]\n",
+			mode:     CountWords,
+			want:     Count{Lines: 1, Characters: 19, Words: 3},
+			speakers: map[string]Count{"Mash": {Lines: 1, Characters: 19, Words: 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CountScript(tt.script, tt.mode)
+			if got.Lines != tt.want.Lines || got.Characters != tt.want.Characters || got.Words != tt.want.Words {
+				t.Errorf("got %d lines, %d characters, %d words, want %d, %d, %d",
+					got.Lines, got.Characters, got.Words, tt.want.Lines, tt.want.Characters, tt.want.Words)
+			}
+			if !reflect.DeepEqual(got.Speakers, tt.speakers) {
+				t.Errorf("got speakers %v, want %v", got.Speakers, tt.speakers)
+			}
+		})
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []Node
+	}{
+		{
+			name:   "speaker block",
+			script: "＠A：マシュ\nはい\n[k]",
+			want: []Node{&SpeakerBlock{
+				Slot:   "A",
+				Name:   "マシュ",
+				Lines:  []*TextLine{{Inlines: []Inline{&Text{Value: "はい"}}, Line: 2}},
+				Closed: true,
+				Line:   1,
+			}},
+		},
+		{
+			name:   "speaker with an ASCII colon",
+			script: "＠B:Fou\n[k]",
+			want:   []Node{&SpeakerBlock{Slot: "B", Name: "Fou", Closed: true, Line: 1}},
+		},
+		{
+			name:   "unclosed block",
+			script: "＠A：マシュ\nはい",
+			want: []Node{&SpeakerBlock{
+				Slot:  "A",
+				Name:  "マシュ",
+				Lines: []*TextLine{{Inlines: []Inline{&Text{Value: "はい"}}, Line: 2}},
+				Line:  1,
+			}},
+		},
+		{
+			name:   "choices and the line closing them",
+			script: "＠A：マシュ\n？1：はい\n？2：[#計画:コト]\n？！",
+			want: []Node{
+				&SpeakerBlock{Slot: "A", Name: "マシュ", Line: 1},
+				&Choice{Number: "1", Text: &TextLine{Inlines: []Inline{&Text{Value: "はい"}}, Line: 2}},
+				&Choice{Number: "2", Text: &TextLine{Inlines: []Inline{&Ruby{Base: "計画", Reading: "コト"}}, Line: 3}},
+				&ChoiceEnd{Line: 4},
+			},
+		},
+		{
+			name:   "question mark without a choice number",
+			script: "？？？",
+			want:   []Node{&TextLine{Inlines: []Inline{&Text{Value: "？？？"}}, Line: 1}},
+		},
+		{
+			name:   "page break outside of a speaker block",
+			script: "[wt 1.0][k]",
+			want: []Node{
+				&TextLine{Inlines: []Inline{&FunctionTag{Name: "wt", Args: []string{"1.0"}}}, Line: 1},
+				&PageBreak{Line: 1},
+			},
+		},
+		{
+			name:   "unclosed bracket",
+			script: "あ[r",
+			want:   []Node{&TextLine{Inlines: []Inline{&Text{Value: "あ[r"}}, Line: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseScript(tt.script).Nodes
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got nodes %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Inline
+	}{
+		{"#計画:コ　ト", &Ruby{Base: "計画", Reading: "コ　ト"}},
+		{"#強調", &Ruby{Base: "強調"}},
+		{"&ああ:うん", &Gender{Male: "ああ", Female: "うん"}},
+		{"r", &FunctionTag{Name: "r", Args: []string{}}},
+		{"line 3", &FunctionTag{Name: "line", Args: []string{"3"}}},
+		{"image *", &FunctionTag{Name: "image", Args: []string{"*"}}},
+		{"", &FunctionTag{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := parseTag(tt.tag); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTag(%q) = %#v, want %#v", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
+
+// regexCount is how scripts were counted before they were parsed, kept to check that
+// the parser counts the same on scripts that the regexes handled correctly
+func regexCount(data string) Count {
+	r := regexp.MustCompile(`(＠([A-Z][：:])?(.*)\n)(.*?\n(?:.*?\n)?)?(.*?)\n\[k\]|(？.+?：.+)`)
+	matches := r.FindAllString(data, -1)
+	characters := 0
+	r = regexp.MustCompile(`(\[[^#&]+?\]|[\[\]#&:]|？.+?：|^＠.+|\n)`)
+	for _, m := range matches {
+		characters += len([]rune(r.ReplaceAllString(m, "")))
+	}
+	return Count{Lines: len(matches), Characters: characters}
+}
+
+func TestCountScriptMatchesRegexCount(t *testing.T) {
+	// Narration is left out, as the regexes counted the ＠ of a line without a name
+	scripts := map[string]string{
+		"jp": `＄01-00-01-00-1-0
+[soundStopAll]
+[bgm BGM_EVENT_1 0.1]
+[scene 10000]
+[charaSet A 1098123000 1 マシュ]
+[charaFace A 0]
+[fadein black 1.0]
+[wt 1.0]
+
+＠A：マシュ
+先輩、[#計画:コ　ト]の準備は
+できていますか？
+[k]
+
+＠B：ダ・ヴィンチ
+[&彼:彼女]が来るまで待とう。[r]大丈夫だよ。
+[k]
+
+？1：もちろん
+？2：まだ
+？！
+
+＠A：マシュ
+[line 3]はい！
+[k]
+
+[fadeout black 1.0]
+[end]
+`,
+		"na": `＄01-00-01-00-1-0
+[scene 10000]
+[charaSet A 1098123000 1 Mash]
+
+＠A：Mash
+Senpai, are you ready for
+the [#operation]?
+[k]
+
+？1：Of course.
+？！
+
+＠Mash
+Then let's go[line 3]
+[k]
+
+[end]
+`,
+		"short blocks": "＠B：フォウ\nフォウ！\n[k]\n？1：[&ああ:うん]\n？！\n",
+	}
+	for name, script := range scripts {
+		t.Run(name, func(t *testing.T) {
+			got, want := CleanAndCountScript(script), regexCount(script)
+			if got.Lines != want.Lines || got.Characters != want.Characters {
+				t.Errorf("got %d lines and %d characters, regexes counted %d and %d",
+					got.Lines, got.Characters, want.Lines, want.Characters)
+			}
+			if got.Lines == 0 {
+				t.Errorf("counted no lines")
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package fgoscript
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Progress is a snapshot of how far a client has come in a run
+type Progress struct {
+	Wars    ProgressCount
+	Quests  ProgressCount
+	Scripts ProgressCount
+	// Item that was most recently started, e.g. "war 100" or "script 0100000111"
+	Current string
+}
+
+// ProgressCount is the number of items finished out of the total found so far.
+// Totals grow as wars and quests are fetched and their scripts are found.
+type ProgressCount struct {
+	Done  int
+	Total int
+}
+
+// progressTracker keeps track of a client's progress and reports every change to OnProgress
+type progressTracker struct {
+	mu       sync.Mutex
+	progress Progress
+	report   func(Progress)
+	// Scripts left to finish per quest ID
+	questScripts map[int]int
+}
+
+// tracker returns the client's progress tracker, or nil if there's no OnProgress callback
+func (c *Client) tracker() *progressTracker {
+	c.initProgress.Do(func() {
+		if c.OnProgress != nil {
+			c.progress = &progressTracker{report: c.OnProgress, questScripts: make(map[int]int)}
+		}
+	})
+	return c.progress
+}
+
+// update applies f to the progress and reports the result.
+// Calls are serialized, so OnProgress is never called concurrently.
+func (t *progressTracker) update(f func(p *Progress)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f(&t.progress)
+	t.report(t.progress)
+}
+
+func (t *progressTracker) addWars(n int) {
+	t.update(func(p *Progress) { p.Wars.Total += n })
+}
+
+func (t *progressTracker) warDone() {
+	t.update(func(p *Progress) { p.Wars.Done++ })
+}
+
+// addScripts adds scripts to the totals, along with any quests they belong to that weren't known yet
+func (t *progressTracker) addScripts(scripts []Script) {
+	t.update(func(p *Progress) {
+		p.Scripts.Total += len(scripts)
+		for _, s := range scripts {
+			if s.QuestId == 0 {
+				continue
+			}
+			if _, found := t.questScripts[s.QuestId]; !found {
+				p.Quests.Total++
+			}
+			t.questScripts[s.QuestId]++
+		}
+	})
+}
+
+// scriptDone marks a script, and its quest if it was the last one left, as finished
+func (t *progressTracker) scriptDone(s Script) {
+	t.update(func(p *Progress) {
+		p.Scripts.Done++
+		if s.QuestId == 0 {
+			return
+		}
+		t.questScripts[s.QuestId]--
+		if t.questScripts[s.QuestId] == 0 {
+			p.Quests.Done++
+		}
+	})
+}
+
+func (t *progressTracker) fetching(kind, id string) {
+	t.update(func(p *Progress) { p.Current = fmt.Sprintf("%s %s", kind, id) })
+}
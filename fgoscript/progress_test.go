@@ -0,0 +1,58 @@
+package fgoscript
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/nice/JP/war/9001", atlasResponse{http.StatusOK, `{
+		"name": "Test War",
+		"spots": [{"quests": [
+			{"id": 1, "name": "First", "type": "main", "phaseScripts": [
+				{"phase": 1, "scripts": [` + scriptJSON("9001000010") + `]},
+				{"phase": 2, "scripts": [` + scriptJSON("9001000011") + `]}
+			]},
+			{"id": 2, "name": "Second", "type": "main", "phaseScripts": [{"phase": 1, "scripts": [` + scriptJSON("9001000020") + `]}]}
+		]}]
+	}`})
+	for _, id := range []string{"9001000010", "9001000011", "9001000020"} {
+		s.handle("/JP/Script/90/"+id+".txt", atlasResponse{http.StatusOK, testScript})
+	}
+
+	var mu sync.Mutex
+	var updates []Progress
+	c := s.client()
+	c.OnProgress = func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, p)
+	}
+	if _, err := c.ParseFromAtlas(context.Background(), []string{"9001"}, IdTypeWar); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(updates) == 0 {
+		t.Fatal("got no progress updates")
+	}
+	fetchedScript := false
+	for _, p := range updates {
+		for _, count := range []ProgressCount{p.Wars, p.Quests, p.Scripts} {
+			if count.Done > count.Total {
+				t.Errorf("got %d done out of %d in %+v", count.Done, count.Total, p)
+			}
+		}
+		fetchedScript = fetchedScript || strings.HasPrefix(p.Current, "script ")
+	}
+	if !fetchedScript {
+		t.Error("got no progress update for the current script")
+	}
+	want := Progress{Wars: ProgressCount{1, 1}, Quests: ProgressCount{2, 2}, Scripts: ProgressCount{3, 3}}
+	if last := updates[len(updates)-1]; last.Wars != want.Wars || last.Quests != want.Quests || last.Scripts != want.Scripts {
+		t.Errorf("got final progress %+v, want %+v", last, want)
+	}
+}
@@ -0,0 +1,39 @@
+package fgoscript
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Region is an Atlas DB game region
+type Region string
+
+const (
+	RegionJP Region = "JP"
+	RegionNA Region = "NA"
+	RegionCN Region = "CN"
+	RegionKR Region = "KR"
+	RegionTW Region = "TW"
+)
+
+// Regions lists every supported region
+var Regions = []Region{RegionJP, RegionNA, RegionCN, RegionKR, RegionTW}
+
+// ParseRegion returns the region for a region code such as "JP" or "na"
+func ParseRegion(s string) (Region, error) {
+	for _, r := range Regions {
+		if strings.EqualFold(s, string(r)) {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("unknown region %q. Must be one of JP, NA, CN, KR or TW", s)
+}
+
+// CountMode returns how the scripts of the region are counted.
+// NA scripts are in English, so words are counted as well as characters.
+func (r Region) CountMode() CountMode {
+	if r == RegionNA {
+		return CountWords
+	}
+	return CountCharacters
+}
@@ -0,0 +1,76 @@
+package fgoscript
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestParseRegion(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Region
+		wantErr bool
+	}{
+		{"JP", RegionJP, false},
+		{"na", RegionNA, false},
+		{"Tw", RegionTW, false},
+		{"EU", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRegion(tt.s)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseRegion(%q) = %q, %v, want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestRegionURLs(t *testing.T) {
+	tests := []struct {
+		region Region
+		api    string
+		script string
+	}{
+		{RegionJP, "http://api.test/nice/JP/war/100?lang=en", "http://static.test/JP/Script/01/0100000010.txt"},
+		{RegionNA, "http://api.test/nice/NA/war/100", "http://static.test/NA/Script/01/0100000010.txt"},
+		{RegionKR, "http://api.test/nice/KR/war/100", "http://static.test/KR/Script/01/0100000010.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.region), func(t *testing.T) {
+			c := NewClient(tt.region)
+			c.APIURL, c.StaticURL = "http://api.test/", "http://static.test"
+			if got := c.apiURL("war", "100"); got != tt.api {
+				t.Errorf("got API URL %q, want %q", got, tt.api)
+			}
+			if got := c.scriptURL(DefaultStaticURL + "/" + string(tt.region) + "/Script/01/0100000010.txt"); got != tt.script {
+				t.Errorf("got script URL %q, want %q", got, tt.script)
+			}
+		})
+	}
+}
+
+func TestRegionWordCount(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/NA/Script/01/0100000010.txt", atlasResponse{http.StatusOK, "＠A：Mash\nSenpai, are you okay?\n[k]\n"})
+	s.handle("/JP/Script/01/0100000010.txt", atlasResponse{http.StatusOK, testScript})
+
+	na := s.client()
+	na.Region = RegionNA
+	result, err := na.FetchSingleScript(context.Background(), "0100000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count.Words != 4 || result.Count.WordCount() != 4 {
+		t.Errorf("got %d words for NA, want 4", result.Count.Words)
+	}
+
+	result, err = s.client().FetchSingleScript(context.Background(), "0100000010")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// JP only counts characters, and the word count is estimated from them
+	if result.Count.Words != 0 || result.Count.WordCount() != result.Count.Characters/2 {
+		t.Errorf("got %d words for JP, want none counted", result.Count.Words)
+	}
+}
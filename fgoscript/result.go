@@ -0,0 +1,119 @@
+package fgoscript
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParseResult is the total count for a single parsed ID or path, and the
+// items it is made up of
+type ParseResult struct {
+	// Atlas ID of the war, quest or script, or the phase number. Empty for local files
+	Id    string     `json:"id"`
+	Name  string     `json:"name"`
+	Kind  ResultKind `json:"kind"`
+	Count Count      `json:"count"`
+	// Story arc of a war, or of a directory matched to a war. See Wars
+	Arc string `json:"arc,omitempty"`
+	// URL or path of the script file. Only set for single scripts and files
+	Source string `json:"source,omitempty"`
+	// Scripts that could not be fetched or read. If there are any, Count is incomplete
+	Failed []*ScriptError `json:"failed,omitempty"`
+	// Counted dialogue of a single script or file. Only set if the client keeps dialogue
+	Dialogue []DialogueLine `json:"dialogue,omitempty"`
+	// Hash of the contents of a single script or file, used to find duplicates
+	Hash string `json:"hash,omitempty"`
+	// Scripts left out of Count because they have the same contents as a script counted before them
+	Duplicates []*Duplicate `json:"duplicates,omitempty"`
+	// The quests of a war, phases of a quest, scripts of a phase, files in a directory or
+	// results in a group. Their counts add up to Count
+	Children []ParseResult `json:"children,omitempty"`
+}
+
+// ResultKind is the kind of item a result was counted for
+type ResultKind string
+
+const (
+	KindWar       ResultKind = "war"
+	KindQuest     ResultKind = "quest"
+	KindPhase     ResultKind = "phase"
+	KindScript    ResultKind = "script"
+	KindDirectory ResultKind = "directory"
+	KindFile      ResultKind = "file"
+	KindGroup     ResultKind = "group"
+)
+
+// newParentResult returns a result with the combined count, failed scripts and duplicates of its children
+func newParentResult(kind ResultKind, id, name string, children []ParseResult) ParseResult {
+	result := ParseResult{Id: id, Name: name, Kind: kind, Children: children}
+	for _, child := range children {
+		result.Count = result.Count.Add(child.Count)
+		result.Failed = append(result.Failed, child.Failed...)
+		result.Duplicates = append(result.Duplicates, child.Duplicates...)
+	}
+	return result
+}
+
+// GroupResults returns a result grouping other results, such as the wars in part of a
+// collection, with their combined count, failed scripts and duplicates
+func GroupResults(name string, results []ParseResult) ParseResult {
+	group := newParentResult(KindGroup, "", name, results)
+	slices.SortFunc(group.Failed, func(a, b *ScriptError) int {
+		return strings.Compare(a.ScriptId, b.ScriptId)
+	})
+	return group
+}
+
+// scriptResult counts the contents of a script file in the client region's count mode.
+// The result has the script's hash, and its dialogue if the client keeps it
+func (c *Client) scriptResult(data string) ParseResult {
+	document := ParseScript(data)
+	result := ParseResult{Count: document.Count(c.Region.CountMode()), Hash: hashScript(data)}
+	if c.KeepDialogue {
+		result.Dialogue = document.Dialogue()
+	}
+	return result
+}
+
+// Incomplete reports whether any scripts are missing from the count
+func (r ParseResult) Incomplete() bool {
+	return len(r.Failed) > 0
+}
+
+// ScriptError is a script that could not be fetched or read
+type ScriptError struct {
+	// Atlas script ID, or file path for local scripts
+	ScriptId string
+	Err      error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("script %s: %s", e.ScriptId, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// scriptErrorJSON is how a ScriptError is written to JSON. The error is kept as its message
+type scriptErrorJSON struct {
+	ScriptId string `json:"scriptId"`
+	Error    string `json:"error"`
+}
+
+func (e *ScriptError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(scriptErrorJSON{e.ScriptId, e.Err.Error()})
+}
+
+func (e *ScriptError) UnmarshalJSON(data []byte) error {
+	var s scriptErrorJSON
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	e.ScriptId = s.ScriptId
+	e.Err = errors.New(s.Error)
+	return nil
+}
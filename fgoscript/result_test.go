@@ -0,0 +1,84 @@
+package fgoscript
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestResultTree(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/nice/JP/war/9001", atlasResponse{http.StatusOK, `{
+		"name": "Test War",
+		"spots": [{"quests": [
+			{"id": 1, "name": "First", "type": "main", "phaseScripts": [
+				{"phase": 1, "scripts": [` + scriptJSON("9001000010") + `, ` + scriptJSON("9001000011") + `]},
+				{"phase": 2, "scripts": [` + scriptJSON("9001000012") + `]}
+			]},
+			{"id": 2, "name": "Second", "type": "main", "phaseScripts": [{"phase": 1, "scripts": [` + scriptJSON("9001000020") + `]}]}
+		]}]
+	}`})
+	scripts := map[string]string{
+		"9001000010": "＠A：マシュ\n先輩！\n[k]\n",
+		"9001000011": "＠B：ダ・ヴィンチ\nはい\n[k]\n＠A：マシュ\nいいえ\n[k]\n",
+		"9001000012": "＠A：マシュ\nマスター\n[k]\n",
+		"9001000020": "＠B：ダ・ヴィンチ\nよし\n[k]\n",
+	}
+	for id, script := range scripts {
+		s.handle("/JP/Script/90/"+id+".txt", atlasResponse{http.StatusOK, script})
+	}
+
+	results, err := s.client().ParseFromAtlas(context.Background(), []string{"9001"}, IdTypeWar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	war := results[0]
+	if war.Kind != KindWar || war.Count.Lines != 5 || war.Count.Speakers["マシュ"].Lines != 3 || war.Count.Speakers["ダ・ヴィンチ"].Lines != 2 {
+		t.Errorf("got war %s with %+v, want 5 lines from both speakers", war.Kind, war.Count)
+	}
+
+	tests := []struct {
+		path  []int
+		kind  ResultKind
+		id    string
+		name  string
+		lines int
+	}{
+		{[]int{0}, KindQuest, "1", "First", 4},
+		{[]int{1}, KindQuest, "2", "Second", 1},
+		{[]int{0, 0}, KindPhase, "1", "Phase 1", 3},
+		{[]int{0, 1}, KindPhase, "2", "Phase 2", 1},
+		{[]int{0, 0, 1}, KindScript, "9001000011", "9001000011", 2},
+		{[]int{1, 0, 0}, KindScript, "9001000020", "9001000020", 1},
+	}
+	for _, tt := range tests {
+		r := war
+		for _, i := range tt.path {
+			if i >= len(r.Children) {
+				t.Fatalf("%v: %s has only %d children", tt.path, r.Name, len(r.Children))
+			}
+			r = r.Children[i]
+		}
+		if r.Kind != tt.kind || r.Id != tt.id || r.Name != tt.name || r.Count.Lines != tt.lines {
+			t.Errorf("%v: got %s %s %q with %d lines, want %s %s %q with %d", tt.path, r.Kind, r.Id, r.Name, r.Count.Lines, tt.kind, tt.id, tt.name, tt.lines)
+		}
+	}
+}
+
+func TestParseQuestSkipsQuestLevel(t *testing.T) {
+	s := newAtlasServer(t)
+	s.handle("/nice/JP/quest/9001", atlasResponse{http.StatusOK, `{
+		"id": 9001, "name": "Test Quest",
+		"phaseScripts": [{"phase": 1, "scripts": [` + scriptJSON("9001000010") + `]}]
+	}`})
+	s.handle("/JP/Script/90/9001000010.txt", atlasResponse{http.StatusOK, testScript})
+
+	results, err := s.client().ParseFromAtlas(context.Background(), []string{"9001"}, IdTypeQuest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	quest := results[0]
+	if quest.Kind != KindQuest || len(quest.Children) != 1 || quest.Children[0].Kind != KindPhase {
+		t.Errorf("got %s with children %+v, want the quest's phases directly below it", quest.Kind, quest.Children)
+	}
+}
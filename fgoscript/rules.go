@@ -0,0 +1,143 @@
+package fgoscript
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+)
+
+//go:embed rules.json
+var defaultRulesData []byte
+
+// Rules are the special cases applied when fetching scripts from Atlas, for wars
+// and scripts that Atlas lists differently from how they are played. The excluded
+// scripts and aliases also apply to script IDs and local files
+type Rules struct {
+	// Rules for wars, by war ID
+	Wars map[string]WarRule `json:"wars,omitempty"`
+	// Script IDs that are the same script as another, by the ID of the one that is
+	// counted instead. An alias is only left out if that script is counted with it
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// Script IDs that are never counted
+	ExcludeScripts []string `json:"excludeScripts,omitempty"`
+}
+
+// WarRule changes how a war is fetched
+type WarRule struct {
+	// Why the rule exists. Not used when fetching
+	Note string `json:"note,omitempty"`
+	// Name used instead of the war name from Atlas
+	Name string `json:"name,omitempty"`
+	// Quests whose scripts are added to the war, e.g. appendix quests missing from its quest list
+	ExtraQuests []string `json:"extraQuests,omitempty"`
+}
+
+// DefaultRules returns the built-in rules
+var DefaultRules = sync.OnceValue(func() *Rules {
+	rules, err := ParseRules(defaultRulesData)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+})
+
+// ParseRules reads rules from JSON
+func ParseRules(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	if err := rules.validate(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// validate checks that no alias points to another alias, which also rules out cycles
+func (r *Rules) validate() error {
+	for _, alias := range slices.Sorted(maps.Keys(r.Aliases)) {
+		id := r.Aliases[alias]
+		if _, found := r.Aliases[id]; found || alias == id {
+			return fmt.Errorf("script %s is an alias of %s, which can't be an alias itself", alias, id)
+		}
+	}
+	return nil
+}
+
+// Merge returns the rules with other added on top. A war rule in other replaces
+// the rule for the same war, and an alias in other replaces the alias of the same script.
+// The aliases are checked again once merged, as other can chain onto an alias in r
+func (r *Rules) Merge(other *Rules) (*Rules, error) {
+	merged := &Rules{
+		Wars:           maps.Clone(r.Wars),
+		Aliases:        maps.Clone(r.Aliases),
+		ExcludeScripts: slices.Clone(r.ExcludeScripts),
+	}
+	if merged.Wars == nil {
+		merged.Wars = make(map[string]WarRule)
+	}
+	if merged.Aliases == nil {
+		merged.Aliases = make(map[string]string)
+	}
+	maps.Copy(merged.Wars, other.Wars)
+	maps.Copy(merged.Aliases, other.Aliases)
+	for _, id := range other.ExcludeScripts {
+		if !slices.Contains(merged.ExcludeScripts, id) {
+			merged.ExcludeScripts = append(merged.ExcludeScripts, id)
+		}
+	}
+	if err := merged.validate(); err != nil {
+		return nil, err
+	}
+	return merged, nil
+}
+
+// filterScripts leaves out the excluded scripts, and the aliases of scripts that are also listed
+func (r *Rules) filterScripts(scripts []Script) []Script {
+	listed := make(map[string]bool, len(scripts))
+	for _, script := range scripts {
+		listed[script.ScriptId] = true
+	}
+	var filtered []Script
+	for _, script := range scripts {
+		if !r.skips(script.ScriptId, listed) {
+			filtered = append(filtered, script)
+		}
+	}
+	return filtered
+}
+
+// filterIds leaves out the excluded script IDs, and the aliases of IDs that are also listed
+func (r *Rules) filterIds(ids []string) []string {
+	listed := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		listed[id] = true
+	}
+	var filtered []string
+	for _, id := range ids {
+		if !r.skips(id, listed) {
+			filtered = append(filtered, id)
+		}
+	}
+	return filtered
+}
+
+// skips reports whether a script is left out, given the IDs of the scripts listed with it
+func (r *Rules) skips(id string, listed map[string]bool) bool {
+	if slices.Contains(r.ExcludeScripts, id) {
+		return true
+	}
+	alias, found := r.Aliases[id]
+	return found && listed[alias]
+}
+
+// rules returns the client's rules, or the built-in rules if it has none
+func (c *Client) rules() *Rules {
+	if c.Rules == nil {
+		return DefaultRules()
+	}
+	return c.Rules
+}
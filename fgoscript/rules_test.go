@@ -0,0 +1,101 @@
+package fgoscript
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMergeRulesValidatesAliases(t *testing.T) {
+	base := &Rules{Aliases: map[string]string{"0100000020": "0100000010"}}
+	tests := []struct {
+		name    string
+		aliases map[string]string
+		wantErr bool
+	}{
+		{"separate alias", map[string]string{"0100000040": "0100000030"}, false},
+		{"replaced alias", map[string]string{"0100000020": "0100000030"}, false},
+		{"chain onto an alias", map[string]string{"0100000030": "0100000020"}, true},
+		{"alias of an aliased script", map[string]string{"0100000010": "0100000030"}, true},
+		{"cycle", map[string]string{"0100000010": "0100000020"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := base.Merge(&Rules{Aliases: tt.aliases})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFilterIds(t *testing.T) {
+	rules := &Rules{
+		Aliases:        map[string]string{"0100000020": "0100000010"},
+		ExcludeScripts: []string{"0100000030"},
+	}
+	tests := []struct {
+		ids  []string
+		want []string
+	}{
+		{[]string{"0100000010", "0100000020", "0100000030"}, []string{"0100000010"}},
+		{[]string{"0100000020"}, []string{"0100000020"}},
+		{[]string{"0100000030"}, nil},
+	}
+	for _, tt := range tests {
+		if got := rules.filterIds(tt.ids); !slices.Equal(got, tt.want) {
+			t.Errorf("filterIds(%v) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+}
+
+func TestParseFromLocalRules(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"0100000010.txt": "＠A：マシュ\n先輩！\n[k]\n",
+		"0100000020.txt": "＠A：マシュ\n先輩、先輩！\n[k]\n",
+		"0100000030.txt": "＠A：マシュ\nはい\n[k]\n",
+		"0100000040.txt": "＠A：マシュ\nいいえ\n[k]\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewClient(RegionJP)
+	c.Rules = &Rules{
+		Aliases:        map[string]string{"0100000020": "0100000010"},
+		ExcludeScripts: []string{"0100000030"},
+	}
+
+	results, err := c.ParseFromLocal(context.Background(), []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, child := range results[0].Children {
+		names = append(names, child.Name)
+	}
+	if want := []string{"0100000010", "0100000040"}; !slices.Equal(names, want) {
+		t.Errorf("got files %v from a directory, want %v", names, want)
+	}
+
+	var paths []string
+	for _, name := range []string{"0100000020.txt", "0100000030.txt", "0100000040.txt"} {
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	results, err = c.ParseFromLocal(context.Background(), paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, r := range results {
+		names = append(names, r.Name)
+	}
+	// The alias is counted, as the script it's an alias of isn't listed
+	if want := []string{"0100000020", "0100000040"}; !slices.Equal(names, want) {
+		t.Errorf("got files %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,122 @@
+package fgoscript
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//go:embed wars.json
+var warsData []byte
+
+// WarInfo is the canonical naming of a war, shared by Atlas and local results
+type WarInfo struct {
+	// Atlas war ID
+	Id string `json:"id"`
+	// Canonical English name
+	En string `json:"en"`
+	// Canonical Japanese name
+	Jp string `json:"jp"`
+	// Story arc the war is part of, e.g. "Part 1"
+	Arc string `json:"arc"`
+	// Case insensitive regular expressions matching the names of local directories for the war
+	Patterns []string `json:"patterns,omitempty"`
+
+	patterns []*regexp.Regexp
+	idRegex  *regexp.Regexp
+}
+
+// NameStyle is which name is used for the wars in the war table
+type NameStyle string
+
+const (
+	// The canonical English name. Used when a client has no name style
+	NamesEnglish NameStyle = "en"
+	// The canonical Japanese name
+	NamesJapanese NameStyle = "jp"
+	// The war name from Atlas, or the directory name for local files, as is
+	NamesRaw NameStyle = "raw"
+)
+
+// NameStyles lists every name style
+var NameStyles = []NameStyle{NamesEnglish, NamesJapanese, NamesRaw}
+
+// ParseNameStyle returns the name style for a string such as "en" or "raw"
+func ParseNameStyle(s string) (NameStyle, error) {
+	for _, style := range NameStyles {
+		if strings.EqualFold(s, string(style)) {
+			return style, nil
+		}
+	}
+	return "", fmt.Errorf("unknown name style %q. Must be one of en, jp or raw", s)
+}
+
+// Wars returns the embedded war table, in story order
+var Wars = sync.OnceValue(func() []WarInfo {
+	var wars []WarInfo
+	if err := json.Unmarshal(warsData, &wars); err != nil {
+		panic(err)
+	}
+	for i := range wars {
+		w := &wars[i]
+		for _, p := range w.Patterns {
+			w.patterns = append(w.patterns, regexp.MustCompile("(?i)"+p))
+		}
+		// The ID on its own, e.g. "101" or "war_101", but not "1010"
+		w.idRegex = regexp.MustCompile(`(?:^|\D)` + regexp.QuoteMeta(w.Id) + `(?:\D|$)`)
+	}
+	return wars
+})
+
+// FindWar returns the war with the given Atlas ID from the war table
+func FindWar(id string) (WarInfo, bool) {
+	for _, w := range Wars() {
+		if w.Id == id {
+			return w, true
+		}
+	}
+	return WarInfo{}, false
+}
+
+// MatchWar returns the war a local directory is for, matching its name against the
+// war IDs first and the name patterns of every war after that
+func MatchWar(name string) (WarInfo, bool) {
+	for _, w := range Wars() {
+		if w.idRegex.MatchString(name) {
+			return w, true
+		}
+	}
+	for _, w := range Wars() {
+		for _, p := range w.patterns {
+			if p.MatchString(name) {
+				return w, true
+			}
+		}
+	}
+	return WarInfo{}, false
+}
+
+// Name returns the name of the war in the given style, or raw for NamesRaw
+func (w WarInfo) Name(style NameStyle, raw string) string {
+	switch style {
+	case NamesRaw:
+		return raw
+	case NamesJapanese:
+		return w.Jp
+	}
+	return w.En
+}
+
+// Title returns the name of the style for display
+func (s NameStyle) Title() string {
+	switch s {
+	case NamesJapanese:
+		return "Japanese"
+	case NamesRaw:
+		return "Raw"
+	}
+	return "English"
+}
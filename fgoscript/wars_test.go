@@ -0,0 +1,46 @@
+package fgoscript
+
+import "testing"
+
+func TestMatchWar(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"101", "101"},
+		{"war_101", "101"},
+		{"1010", ""},
+		{"Orleans", "101"},
+		{"オルレアン", "101"},
+		{"Gotterdammerung", "302"},
+		{"Heian-kyo", "307"},
+		{"平安京", "307"},
+		{"lb6 avalon le fae", "308"},
+		{"妖精円卓領域", "308"},
+		{"Traum", "309"},
+		{"trauma", ""},
+		{"Nahui Mictlan", "310"},
+		{"war_310", "310"},
+		{"Ordeal Call II", "403"},
+		{"oc2", "403"},
+		{"oc20", ""},
+		{"Ordeal Call I", ""},
+		{"events", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			war, found := MatchWar(tt.name)
+			if found != (tt.want != "") || war.Id != tt.want {
+				t.Errorf("MatchWar(%q) = %q, %t, want %q", tt.name, war.Id, found, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleWarsInTable(t *testing.T) {
+	for id := range DefaultRules().Wars {
+		if _, found := FindWar(id); !found {
+			t.Errorf("war %s has a built-in rule but isn't in the war table", id)
+		}
+	}
+}
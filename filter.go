@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"fgo-script-parser/fgoscript"
+)
+
+// newResultMatcher returns a function reporting whether a result's name or ID
+// matches the filter, either as a case-insensitive substring or as a regex.
+// An empty filter matches every result
+func newResultMatcher(filter string, regex bool) (func(fgoscript.ParseResult) bool, error) {
+	if filter == "" {
+		return func(fgoscript.ParseResult) bool { return true }, nil
+	}
+
+	if regex {
+		re, err := regexp.Compile("(?i)" + filter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex. %s", err)
+		}
+		return func(r fgoscript.ParseResult) bool {
+			return re.MatchString(r.Name) || re.MatchString(r.Id)
+		}, nil
+	}
+
+	filter = strings.ToLower(filter)
+	return func(r fgoscript.ParseResult) bool {
+		return strings.Contains(strings.ToLower(r.Name), filter) || strings.Contains(strings.ToLower(r.Id), filter)
+	}, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestResultMatcher(t *testing.T) {
+	result := fgoscript.ParseResult{Id: "0100000111", Name: "First Singularity: Orleans"}
+	tests := []struct {
+		filter  string
+		regex   bool
+		want    bool
+		wantErr bool
+	}{
+		{"", false, true, false},
+		{"orleans", false, true, false},
+		{"0111", false, true, false},
+		{"septem", false, false, false},
+		// Regex characters are matched as text without regex
+		{"orl.*ns", false, false, false},
+		{"orl.*ns", true, true, false},
+		{"^01.*1$", true, true, false},
+		{"(", true, false, true},
+	}
+	for _, tt := range tests {
+		match, err := newResultMatcher(tt.filter, tt.regex)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newResultMatcher(%q, %t) got error %v", tt.filter, tt.regex, err)
+			continue
+		}
+		if err == nil && match(result) != tt.want {
+			t.Errorf("newResultMatcher(%q, %t) matched %t, want %t", tt.filter, tt.regex, !tt.want, tt.want)
+		}
+	}
+}
+
+func TestFilterResultsTable(t *testing.T) {
+	m := NewModel(Config{}, Options{})
+	m.currentState = Results
+	m.setResults(sortTestResults())
+	m.updateKeymap()
+
+	typeKeys := func(s string) {
+		for _, r := range s {
+			updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+			m = updated.(Model)
+		}
+	}
+	typeKeys("/")
+	if !m.filterInput.Focused() || m.filterInput.Value() != "" {
+		t.Fatalf("got filter %q focused %t, want an empty focused filter", m.filterInput.Value(), m.filterInput.Focused())
+	}
+	// Every key filters the table again, and the summary only counts the shown rows
+	typeKeys("e")
+	if got := resultIds(m.shownResults); !slices.Equal(got, []string{"102", "101"}) {
+		t.Errorf("got rows %v for \"e\", want Septem and Orleans", got)
+	}
+	typeKeys("p")
+	if got := resultIds(m.shownResults); !slices.Equal(got, []string{"102"}) {
+		t.Errorf("got rows %v for \"ep\", want Septem", got)
+	}
+	if total := Summarize(m.shownResults).Total; total.Lines != 30 || total.Characters != 300 {
+		t.Errorf("got total %+v, want only Septem counted", total)
+	}
+
+	// An invalid regex keeps every row until it is fixed
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+	m = updated.(Model)
+	typeKeys("(")
+	updated, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	m = updated.(Model)
+	if m.filterErr == nil || len(m.shownResults) != 3 {
+		t.Errorf("got error %v and %d rows for an invalid regex, want the error and every row", m.filterErr, len(m.shownResults))
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"fgo-script-parser/fgoscript"
+)
+
+// Metadata describes the run that produced a set of results
+type Metadata struct {
+	Tool      string           `json:"tool"`
+	Version   string           `json:"version"`
+	CreatedAt time.Time        `json:"createdAt"`
+	Region    fgoscript.Region `json:"region"`
+	// "atlas" or "local"
+	Source string `json:"source"`
+	// Kind of Atlas IDs parsed. Empty for local runs
+	IdType string `json:"idType,omitempty"`
+	// IDs or paths that were parsed
+	Inputs []string `json:"inputs"`
+	// Name of the collection the war IDs are from, if any
+	Collection string `json:"collection,omitempty"`
+}
+
+// newMetadata returns the metadata of a run started now
+func newMetadata(region fgoscript.Region, source Source, idType fgoscript.AtlasIdType, inputs []string) Metadata {
+	metadata := Metadata{
+		Tool:      "fgo-script-parser",
+		Version:   toolVersion(),
+		CreatedAt: time.Now().UTC(),
+		Region:    region,
+		Source:    source.String(),
+		Inputs:    inputs,
+	}
+	if source == atlas {
+		metadata.IdType = idType.String()
+	}
+	return metadata
+}
+
+// writeJSON writes the metadata, the full result tree and the summary as a single JSON document
+func writeJSON(w io.Writer, results []fgoscript.ParseResult, opts OutputOptions) error {
+	document := struct {
+		Metadata Metadata                `json:"metadata"`
+		Results  []fgoscript.ParseResult `json:"results"`
+		Summary  *Summary                `json:"summary,omitempty"`
+	}{
+		Metadata: opts.Metadata,
+		Results:  results,
+	}
+	if results == nil {
+		document.Results = []fgoscript.ParseResult{}
+	}
+	if !opts.NoSummary {
+		summary := Summarize(results)
+		document.Summary = &summary
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+// writeNDJSON writes one JSON record per line: the metadata, then every
+// result with its children, then the summary. The type field tells them apart
+func writeNDJSON(w io.Writer, results []fgoscript.ParseResult, opts OutputOptions) error {
+	encoder := json.NewEncoder(w)
+	err := encoder.Encode(struct {
+		Type string `json:"type"`
+		Metadata
+	}{"metadata", opts.Metadata})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		err := encoder.Encode(struct {
+			Type string `json:"type"`
+			fgoscript.ParseResult
+		}{"result", r})
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.NoSummary {
+		return nil
+	}
+	return encoder.Encode(struct {
+		Type string `json:"type"`
+		Summary
+	}{"summary", Summarize(results)})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+)
+
+func jsonTestResults() []fgoscript.ParseResult {
+	script := fgoscript.ParseResult{
+		Id: "0100000010", Name: "0100000010", Kind: fgoscript.KindScript, Source: "https://static.atlasacademy.io/JP/Script/01/0100000010.txt",
+		Count:    fgoscript.Count{Lines: 1, Characters: 2, Speakers: map[string]fgoscript.Count{"マシュ": {Lines: 1, Characters: 2}}},
+		Dialogue: []fgoscript.DialogueLine{{Speaker: "マシュ", Text: "はい"}},
+	}
+	failed := &fgoscript.ScriptError{ScriptId: "0100000020", Err: errors.New("unexpected status 500")}
+	return []fgoscript.ParseResult{{
+		Id: "100", Name: "Fuyuki", Kind: fgoscript.KindWar, Arc: "Part 1",
+		Count: script.Count, Failed: []*fgoscript.ScriptError{failed}, Children: []fgoscript.ParseResult{script},
+	}}
+}
+
+func TestWriteJSON(t *testing.T) {
+	metadata := newMetadata(fgoscript.RegionJP, atlas, fgoscript.IdTypeWar, []string{"100"})
+	var b bytes.Buffer
+	if err := WriteResults(&b, jsonTestResults(), OutputOptions{Format: FormatJSON, Metadata: metadata}); err != nil {
+		t.Fatal(err)
+	}
+
+	var document struct {
+		Metadata map[string]any   `json:"metadata"`
+		Results  []map[string]any `json:"results"`
+		Summary  *Summary         `json:"summary"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]any{"tool": "fgo-script-parser", "region": "JP", "source": "atlas", "idType": "war", "inputs": []any{"100"}} {
+		if got := document.Metadata[key]; !jsonEqual(got, want) {
+			t.Errorf("got metadata %s %v, want %v", key, got, want)
+		}
+	}
+	if _, found := document.Metadata["createdAt"]; !found {
+		t.Error("got no createdAt in the metadata")
+	}
+
+	war := document.Results[0]
+	for key, want := range map[string]any{"id": "100", "name": "Fuyuki", "kind": "war", "arc": "Part 1"} {
+		if got := war[key]; !jsonEqual(got, want) {
+			t.Errorf("got result %s %v, want %v", key, got, want)
+		}
+	}
+	count := war["count"].(map[string]any)
+	if count["lines"] != 1.0 || count["characters"] != 2.0 || count["speakers"] == nil {
+		t.Errorf("got count %v, want lines, characters and speakers", count)
+	}
+	failed := war["failed"].([]any)[0].(map[string]any)
+	if failed["scriptId"] != "0100000020" || failed["error"] != "unexpected status 500" {
+		t.Errorf("got failed script %v, want its ID and error", failed)
+	}
+	script := war["children"].([]any)[0].(map[string]any)
+	if script["source"] == nil || script["dialogue"] != nil {
+		t.Errorf("got script %v, want its source and no dialogue without the dialogue option", script)
+	}
+	if document.Summary == nil || document.Summary.Results != 1 || document.Summary.Total.Lines != 1 {
+		t.Errorf("got summary %+v, want the total of the war", document.Summary)
+	}
+
+	// The dialogue is written if asked for, and the summary left out with NoSummary
+	b.Reset()
+	if err := WriteResults(&b, jsonTestResults(), OutputOptions{Format: FormatJSON, Metadata: metadata, Dialogue: true, NoSummary: true}); err != nil {
+		t.Fatal(err)
+	}
+	var withDialogue map[string]any
+	if err := json.Unmarshal(b.Bytes(), &withDialogue); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := withDialogue["summary"]; found {
+		t.Error("got a summary with NoSummary")
+	}
+	script = withDialogue["results"].([]any)[0].(map[string]any)["children"].([]any)[0].(map[string]any)
+	if script["dialogue"] == nil {
+		t.Errorf("got script %v, want its dialogue", script)
+	}
+
+	// No results are still a list
+	b.Reset()
+	if err := WriteResults(&b, nil, OutputOptions{Format: FormatJSON, Metadata: metadata}); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b.Bytes(), []byte(`"results": []`)) {
+		t.Errorf("got %s, want an empty results list", b.String())
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	metadata := newMetadata(fgoscript.RegionNA, local, 0, []string{"./scripts"})
+	results := append(jsonTestResults(), fgoscript.ParseResult{Id: "101", Name: "Orleans", Kind: fgoscript.KindWar})
+	var b bytes.Buffer
+	if err := WriteResults(&b, results, OutputOptions{Format: FormatNDJSON, Metadata: metadata}); err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	scanner := bufio.NewScanner(&b)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("got a line that isn't a JSON record: %s", scanner.Text())
+		}
+		types = append(types, record["type"].(string))
+		if record["type"] == "metadata" && (record["source"] != "local" || record["region"] != "NA" || record["idType"] != nil) {
+			t.Errorf("got metadata %v, want a local NA run without an ID type", record)
+		}
+	}
+	if want := []string{"metadata", "result", "result", "summary"}; !slices.Equal(types, want) {
+		t.Errorf("got records %v, want %v", types, want)
+	}
+}
+
+func TestReadResultsFiles(t *testing.T) {
+	metadata := newMetadata(fgoscript.RegionJP, atlas, fgoscript.IdTypeWar, []string{"100"})
+	for _, format := range []OutputFormat{FormatJSON, FormatNDJSON} {
+		t.Run(format.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "results"+format.extension())
+			var b bytes.Buffer
+			if err := WriteResults(&b, jsonTestResults(), OutputOptions{Format: format, Metadata: metadata, Dialogue: true}); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			read := readJSONResults
+			if format == FormatNDJSON {
+				read = readNDJSONResults
+			}
+			gotMetadata, results, err := read(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotMetadata.Tool != metadata.Tool || gotMetadata.IdType != "war" || !slices.Equal(gotMetadata.Inputs, metadata.Inputs) {
+				t.Errorf("got metadata %+v, want %+v", gotMetadata, metadata)
+			}
+			war := results[0]
+			if war.Name != "Fuyuki" || war.Arc != "Part 1" || len(war.Failed) != 1 || war.Failed[0].Err.Error() != "unexpected status 500" {
+				t.Errorf("got war %+v, want it read back with its failed script", war)
+			}
+			if len(war.Children) != 1 || len(war.Children[0].Dialogue) != 1 {
+				t.Errorf("got children %+v, want the script with its dialogue", war.Children)
+			}
+		})
+	}
+}
+
+func jsonEqual(a, b any) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
@@ -12,9 +12,24 @@ type KeyMap struct {
 	FocusInput key.Binding
 	ClearInput key.Binding
 	Confirm    key.Binding
+	Cancel     key.Binding
 	Quit       key.Binding
 
-	Copy key.Binding
+	Copy         key.Binding
+	ShowSpeakers key.Binding
+	OpenResult   key.Binding
+	ViewScript   key.Binding
+	Sort         key.Binding
+	Export       key.Binding
+	Filter       key.Binding
+	FilterRegex  key.Binding
+	InputDone    key.Binding
+	ShowHistory  key.Binding
+	DeleteRun    key.Binding
+	CompareRun   key.Binding
+
+	PickCollection   key.Binding
+	SelectCollection key.Binding
 }
 
 func DefaultKeybinds() KeyMap {
@@ -28,9 +43,24 @@ func DefaultKeybinds() KeyMap {
 		FocusInput: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "type"), key.WithDisabled()),
 		ClearInput: key.NewBinding(key.WithKeys("ctrl+x"), key.WithHelp("ctrl+x", "clear"), key.WithDisabled()),
 		Confirm:    key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "confirm"), key.WithDisabled()),
+		Cancel:     key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "cancel"), key.WithDisabled()),
 		Quit:       key.NewBinding(key.WithKeys("ctrl+q"), key.WithHelp("ctrl+q", "quit")),
 
-		Copy: key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "copy row"), key.WithDisabled()),
+		Copy:         key.NewBinding(key.WithKeys("ctrl+c"), key.WithHelp("ctrl+c", "copy row"), key.WithDisabled()),
+		ShowSpeakers: key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "speakers"), key.WithDisabled()),
+		OpenResult:   key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "open"), key.WithDisabled()),
+		ViewScript:   key.NewBinding(key.WithKeys("v"), key.WithHelp("v", "view script"), key.WithDisabled()),
+		Sort:         key.NewBinding(key.WithKeys("1", "2", "3", "4", "5"), key.WithHelp("1-5", "sort"), key.WithDisabled()),
+		Export:       key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "export"), key.WithDisabled()),
+		Filter:       key.NewBinding(key.WithKeys("/"), key.WithHelp("/", "filter"), key.WithDisabled()),
+		FilterRegex:  key.NewBinding(key.WithKeys("ctrl+r"), key.WithHelp("ctrl+r", "toggle regex"), key.WithDisabled()),
+		InputDone:    key.NewBinding(key.WithKeys("enter", "esc"), key.WithHelp("enter", "done"), key.WithDisabled()),
+		ShowHistory:  key.NewBinding(key.WithKeys("h"), key.WithHelp("h", "history"), key.WithDisabled()),
+		DeleteRun:    key.NewBinding(key.WithKeys("d"), key.WithHelp("d", "delete run"), key.WithDisabled()),
+		CompareRun:   key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "compare"), key.WithDisabled()),
+
+		PickCollection:   key.NewBinding(key.WithKeys("ctrl+l"), key.WithHelp("ctrl+l", "collections"), key.WithDisabled()),
+		SelectCollection: key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "select"), key.WithDisabled()),
 	}
 }
 
@@ -41,11 +71,25 @@ func (k KeyMap) ShortHelp() []key.Binding {
 		k.PrevState,
 		k.NextOption,
 		k.Copy,
+		k.ShowSpeakers,
+		k.OpenResult,
+		k.ViewScript,
+		k.Sort,
+		k.Export,
+		k.Filter,
+		k.FilterRegex,
+		k.InputDone,
+		k.ShowHistory,
+		k.DeleteRun,
+		k.CompareRun,
+		k.PickCollection,
+		k.SelectCollection,
 		k.Toggle,
 		k.BlurInput,
 		k.FocusInput,
 		k.ClearInput,
 		k.Confirm,
+		k.Cancel,
 		k.Quit,
 	}
 }
@@ -58,11 +102,15 @@ func (k KeyMap) FullHelp() [][]key.Binding {
 }
 
 func (m *Model) updateKeymap() {
-	stateHasOptions := m.currentState == SourceSelect || m.currentState == AtlasTypeSelect || m.currentState == MiscOptions
+	stateHasOptions := m.currentState == SourceSelect || m.currentState == AtlasTypeSelect || m.currentState == MiscOptions ||
+		m.currentState == CollectionSelect
 
 	hasNextstate := true
 	switch {
-	case m.currentState == Results:
+	case m.currentState == Parsing, m.currentState == CollectionSelect:
+		hasNextstate = false
+	case m.currentState == Results, m.currentState == Speakers, m.currentState == ScriptViewer, m.currentState == History,
+		m.currentState == Compare, m.currentState == CompareDialogue:
 		hasNextstate = false
 	case m.currentState == Confirm:
 		if len(m.results) > 0 {
@@ -73,13 +121,44 @@ func (m *Model) updateKeymap() {
 	}
 
 	m.keymap.NextState.SetEnabled(hasNextstate)
-	m.keymap.PrevState.SetEnabled(m.currentState != SourceSelect)
-	m.keymap.NextOption.SetEnabled(stateHasOptions || m.resultsTable.Focused())
+	m.keymap.PrevState.SetEnabled(m.currentState != SourceSelect && m.currentState != Parsing)
+	m.keymap.NextOption.SetEnabled(stateHasOptions || m.currentState == Results || m.currentState == Speakers || m.currentState == ScriptViewer ||
+		m.currentState == History || m.currentState == Compare || m.currentState == CompareDialogue)
 	m.keymap.PrevOption.SetEnabled(stateHasOptions)
 	m.keymap.Toggle.SetEnabled(m.currentState == MiscOptions)
 	m.keymap.Confirm.SetEnabled(m.currentState == Confirm)
+	m.keymap.Cancel.SetEnabled(m.currentState == Parsing)
 	m.keymap.BlurInput.SetEnabled(m.currentState == IdInput && m.IdInput.Focused())
-	m.keymap.ClearInput.SetEnabled(m.currentState == IdInput)
-	m.keymap.FocusInput.SetEnabled(m.currentState == IdInput && !m.IdInput.Focused())
-	m.keymap.Copy.SetEnabled(m.currentState == Results)
+	filtering := m.currentState == Results && m.filterInput.Focused()
+	m.keymap.ClearInput.SetEnabled(m.currentState == IdInput || (m.currentState == Results && !filtering && m.filterInput.Value() != ""))
+	pickedCollection := m.collection != nil && m.selectedSource == atlas
+	m.keymap.FocusInput.SetEnabled(m.currentState == IdInput && !m.IdInput.Focused() && !pickedCollection)
+	m.keymap.PickCollection.SetEnabled(m.currentState == IdInput && m.selectedSource == atlas && len(m.config.collections) > 0)
+	m.keymap.SelectCollection.SetEnabled(m.currentState == CollectionSelect)
+	m.keymap.Copy.SetEnabled(m.currentState == Results && !filtering && len(m.shownResults) > 0)
+	m.keymap.ShowSpeakers.SetEnabled(m.currentState == Results && !filtering && len(m.shownResults) > 0)
+	m.keymap.OpenResult.SetEnabled((m.currentState == Results && !filtering && len(m.shownResults) > 0 &&
+		len(m.shownResults[m.resultsTable.Cursor()].Children) > 0) || (m.currentState == History && len(m.historyRuns) > 0))
+	m.keymap.ViewScript.SetEnabled((m.currentState == Results && !filtering && len(m.shownResults) > 0 &&
+		m.shownResults[m.resultsTable.Cursor()].Source != "") ||
+		(m.currentState == Compare && len(m.compareRows) > 0 && len(m.compareRows[m.compareTable.Cursor()].Dialogue) > 0))
+	m.keymap.Sort.SetEnabled(m.currentState == Results && !filtering)
+	m.keymap.Export.SetEnabled(m.currentState == Results && !filtering && len(m.shownResults) > 0)
+	m.keymap.Filter.SetEnabled(m.currentState == Results && !filtering)
+	m.keymap.FilterRegex.SetEnabled(filtering)
+	m.keymap.ShowHistory.SetEnabled(m.currentState == SourceSelect || m.currentState == Confirm || (m.currentState == Results && !filtering))
+	m.keymap.DeleteRun.SetEnabled(m.currentState == History && len(m.historyRuns) > 0)
+	m.keymap.CompareRun.SetEnabled(m.currentState == History && len(m.historyRuns) > 1)
+	editingOutput := m.currentState == MiscOptions && m.outputInput.Focused()
+	m.keymap.InputDone.SetEnabled(filtering || editingOutput)
+	if editingOutput {
+		m.keymap.NextState.SetEnabled(false)
+		m.keymap.PrevState.SetEnabled(false)
+		m.keymap.NextOption.SetEnabled(false)
+		m.keymap.PrevOption.SetEnabled(false)
+		m.keymap.Toggle.SetEnabled(false)
+	}
+	if filtering {
+		m.keymap.PrevState.SetEnabled(false)
+	}
 }
@@ -1,16 +1,31 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"os"
-
-	tea "github.com/charmbracelet/bubbletea"
+	"os/signal"
+	"runtime/debug"
 )
 
+// version can be set at build time with -ldflags "-X main.version=v1.2.3"
+var version string
+
+// toolVersion returns the version set at build time, or the module version if it was installed with go install
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
+
 func main() {
-	p := tea.NewProgram(NewModel(), tea.WithAltScreen())
-	if _, err := p.Run(); err != nil {
-		fmt.Println("could not run program:", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := newRootCmd().ExecuteContext(ctx); err != nil {
 		os.Exit(1)
 	}
 }
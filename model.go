@@ -1,13 +1,18 @@
 package main
 
 import (
+	"context"
 	"time"
 
+	"fgo-script-parser/fgoscript"
+
 	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/progress"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/stopwatch"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 )
 
@@ -19,18 +24,28 @@ const (
 	SourceMaxCount int = iota
 )
 
-type AtlasIdType int
+func (s Source) String() string {
+	if s == local {
+		return "local"
+	}
+	return "atlas"
+}
 
-const (
-	war AtlasIdType = iota
-	quest
-	script
-	AtlasIdTypeMaxCount int = iota
-)
+const AtlasIdTypeMaxCount int = int(fgoscript.IdTypeScript) + 1
 
 type Options struct {
 	noFile           bool
+	format           OutputFormat
+	ifExists         ExistsPolicy
 	includeWordCount bool
+	region           fgoscript.Region
+	offline          bool
+	keepPartial      bool
+	sort             Sort
+	noSummary        bool
+	keepDuplicates   bool
+	names            fgoscript.NameStyle
+	record           bool
 	// Ignore subdirectory split for local files
 	// Map known main story chapter names (can work for local too with some regex)
 }
@@ -39,7 +54,18 @@ type OptionsEnum int
 
 const (
 	NoFile OptionsEnum = iota
+	FileFormat
+	OutputPath
+	IfExists
 	IncludeWordCount
+	AtlasRegion
+	WarNames
+	Offline
+	KeepPartial
+	NoSummary
+	KeepDuplicates
+	Record
+	ClearCache
 	OptionsMaxCount int = iota
 )
 
@@ -53,16 +79,36 @@ const (
 	Confirm
 	Results
 	Parsing
+	Speakers
+	ScriptViewer
+	History
+	Compare
+	CompareDialogue
+	CollectionSelect
 )
 
 type Model struct {
 	currentOption       OptionsEnum
 	currentState        State
 	selectedSource      Source
-	selectedAtlasIdType AtlasIdType
+	selectedAtlasIdType fgoscript.AtlasIdType
 	options             Options
-	results             []ParseResult
-	notification        notificationMsg
+	config              Config
+	results             []fgoscript.ParseResult
+	// Metadata of the run the results are from
+	runMetadata Metadata
+	// Results opened from the results table, from the top level down.
+	// The table shows the children of the last one
+	resultPath []fgoscript.ParseResult
+	// Results in the order shown in the results table
+	shownResults []fgoscript.ParseResult
+	cacheStats   fgoscript.CacheStats
+	notification notificationMsg
+
+	// Collection of wars parsed instead of the IDs entered, if one is picked
+	collection *Collection
+	// Collection highlighted in the collection picker
+	collectionCursor int
 
 	theme                  Theme
 	help                   help.Model
@@ -70,8 +116,39 @@ type Model struct {
 	statePane, optionsPane viewport.Model
 	IdInput                textarea.Model
 	loadingSpinner         spinner.Model
+	progressBar            progress.Model
 	timer                  stopwatch.Model
 	resultsTable           table.Model
+	filterInput            textinput.Model
+	outputInput            textinput.Model
+	speakerTable           table.Model
+	scriptViewer           viewport.Model
+	// Script shown in the script viewer
+	viewedScript fgoscript.ParseResult
+	historyTable table.Model
+	// Runs in the order shown in the history table
+	historyRuns []StoredRun
+	// State to go back to when leaving the history
+	historyReturn State
+	// Run marked to be compared with the next run picked in the history. Zero if none is
+	compareBase int64
+	compareDiff Diff
+	// IDs of the old and new run being compared
+	compareRuns [2]int64
+	// Changed items in the order shown in the compare table
+	compareRows  []diffRow
+	compareTable table.Model
+
+	// Filter of the results table, matched as a regex instead of a substring if set
+	filterRegex bool
+	filterErr   error
+
+	// Cancels the running parse. Every run gets a new id
+	cancelParse context.CancelFunc
+	parseId     int
+	// Progress of the running parse
+	progress   fgoscript.Progress
+	progressCh chan fgoscript.Progress
 
 	ready                         bool
 	terminalWidth, terminalHeight int
@@ -80,18 +157,68 @@ type Model struct {
 	err                           error
 }
 
-func NewModel() Model {
+// showWordCount reports whether word counts should be shown, which is always
+// the case for regions that count words
+func (m Model) showWordCount() bool {
+	return m.options.includeWordCount || m.options.region.CountMode() == fgoscript.CountWords
+}
+
+// compareWordCount reports whether word counts should be shown when comparing runs
+func (m Model) compareWordCount() bool {
+	return m.options.includeWordCount || m.compareDiff.New.Region.CountMode() == fgoscript.CountWords
+}
+
+// levelResults returns the results at the level of the results table that's open
+func (m Model) levelResults() []fgoscript.ParseResult {
+	if len(m.resultPath) == 0 {
+		return m.results
+	}
+	return m.resultPath[len(m.resultPath)-1].Children
+}
+
+// outputOptions returns the options for writing results of a run to the output file
+func (m Model) outputOptions(metadata Metadata) OutputOptions {
+	return OutputOptions{
+		Format:           m.options.format,
+		IncludeWordCount: m.showWordCount(),
+		NoSummary:        m.options.noSummary,
+		Metadata:         metadata,
+		Template:         m.config.Template,
+		Dialogue:         m.config.Dialogue,
+		TSVSections:      m.config.TSVSections,
+		Path:             m.outputInput.Value(),
+		IfExists:         m.options.ifExists,
+	}
+}
+
+// NewModel returns the TUI model, starting with the given options
+func NewModel(config Config, options Options) Model {
 	body := textarea.New()
 	body.ShowLineNumbers = true
 	body.Prompt = ""
 
+	filter := textinput.New()
+	filter.Prompt = "/ "
+	filter.Placeholder = "name or ID"
+
+	output := textinput.New()
+	output.Prompt = ""
+	output.Placeholder = DefaultOutputPath
+	output.SetValue(config.Output)
+
 	return Model{
 		theme:          DefaultTheme(),
+		filterInput:    filter,
+		outputInput:    output,
 		IdInput:        body,
 		loadingSpinner: spinner.New(),
+		progressBar:    progress.New(progress.WithSolidFill(string(DefaultTheme().SecondaryColor))),
 		help:           help.New(),
 		keymap:         DefaultKeybinds(),
 		currentState:   SourceSelect,
+		options:        options,
+		config:         config,
+		cancelParse:    func() {},
 		timer:          stopwatch.NewWithInterval(time.Millisecond),
 	}
 }
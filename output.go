@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"fgo-script-parser/fgoscript"
+)
+
+// OutputFormat is the file format results are written in
+type OutputFormat int
+
+const (
+	FormatTSV OutputFormat = iota
+	FormatJSON
+	FormatNDJSON
+	FormatMarkdown
+	FormatHTML
+)
+
+var OutputFormats = []OutputFormat{FormatTSV, FormatJSON, FormatNDJSON, FormatMarkdown, FormatHTML}
+
+func (f OutputFormat) String() string {
+	switch f {
+	case FormatTSV:
+		return "tsv"
+	case FormatJSON:
+		return "json"
+	case FormatNDJSON:
+		return "ndjson"
+	case FormatMarkdown:
+		return "md"
+	case FormatHTML:
+		return "html"
+	}
+	return fmt.Sprintf("OutputFormat(%d)", int(f))
+}
+
+// ParseOutputFormat returns the output format for "tsv", "json", "ndjson", "md" or "html"
+func ParseOutputFormat(s string) (OutputFormat, error) {
+	for _, f := range OutputFormats {
+		if strings.EqualFold(s, f.String()) {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown output format %q. Must be one of tsv, json, ndjson, md or html", s)
+}
+
+// extension returns the file extension for the format. Tab-separated
+// files keep the .csv extension so spreadsheets open them directly
+func (f OutputFormat) extension() string {
+	if f == FormatTSV {
+		return ".csv"
+	}
+	return "." + f.String()
+}
+
+// OutputOptions control what is written with the results
+type OutputOptions struct {
+	Format OutputFormat
+	// Include the word count, which is always counted for regions that count words
+	IncludeWordCount bool
+	// Leave out the total, mean and median rows
+	NoSummary bool
+	// Written with the JSON and report formats
+	Metadata Metadata
+	// Path of a template file replacing the embedded Markdown or HTML report template
+	Template string
+	// Write the dialogue of every script, if it was kept, to JSON and NDJSON output
+	Dialogue bool
+	// Leave out the header row of tsv output, e.g. when appending to an existing file
+	NoHeader bool
+	// Add the speaker, failed script and duplicate tables to tsv output after the results
+	TSVSections bool
+
+	// Template of the output file path, see expandOutputPath. Only used when writing to a file
+	Path     string
+	IfExists ExistsPolicy
+}
+
+// WriteResults writes the results to w in the format set in opts
+func WriteResults(w io.Writer, results []fgoscript.ParseResult, opts OutputOptions) error {
+	if !opts.Dialogue {
+		results = withoutDialogue(results)
+	}
+	switch opts.Format {
+	case FormatJSON:
+		return writeJSON(w, results, opts)
+	case FormatNDJSON:
+		return writeNDJSON(w, results, opts)
+	case FormatMarkdown, FormatHTML:
+		return writeReport(w, results, opts)
+	}
+	return writeTSV(w, results, opts)
+}
+
+// writeTSV writes the results as a single tab-separated table to w. With TSVSections,
+// it is followed by the per-speaker breakdown of every result, any scripts that
+// failed and any duplicate scripts that were left out, each separated by an empty line
+func writeTSV(w io.Writer, results []fgoscript.ParseResult, opts OutputOptions) error {
+	includeWordCount := opts.IncludeWordCount
+	writer := csv.NewWriter(w)
+	writer.Comma = '\t'
+
+	// TODO: Don't include ID for local parsing
+	if !opts.NoHeader {
+		writer.Write(countHeader(includeWordCount, "Id", "Name"))
+	}
+	for _, r := range results {
+		writer.Write(countRow(r.Count, includeWordCount, r.Id, r.Name))
+	}
+	if !opts.NoSummary && len(results) > 0 {
+		for _, row := range Summarize(results).Rows() {
+			writer.Write(countRow(row.Count, includeWordCount, "", row.Label))
+		}
+	}
+
+	if !opts.TSVSections {
+		writer.Flush()
+		return writer.Error()
+	}
+
+	// Separate the speaker table from the totals with an empty line
+	writer.Write([]string{})
+	writer.Write(countHeader(includeWordCount, "Id", "Name", "Speaker"))
+	for _, r := range results {
+		for _, s := range r.Count.SortedSpeakers() {
+			writer.Write(countRow(s.Count, includeWordCount, r.Id, r.Name, s.Name))
+		}
+	}
+
+	// Scripts missing from the counts above
+	if slices.ContainsFunc(results, fgoscript.ParseResult.Incomplete) {
+		writer.Write([]string{})
+		writer.Write([]string{"Id", "Name", "Failed script", "Error"})
+		for _, r := range results {
+			for _, f := range r.Failed {
+				writer.Write([]string{r.Id, r.Name, f.ScriptId, f.Err.Error()})
+			}
+		}
+	}
+
+	// Scripts left out of the counts above because they duplicate another script
+	if slices.ContainsFunc(results, func(r fgoscript.ParseResult) bool { return len(r.Duplicates) > 0 }) {
+		writer.Write([]string{})
+		writer.Write(countHeader(includeWordCount, "Id", "Name", "Duplicate script", "Duplicate of"))
+		for _, r := range results {
+			for _, d := range r.Duplicates {
+				writer.Write(countRow(d.Count, includeWordCount, r.Id, r.Name, d.ScriptId, d.DuplicateOf))
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// withoutDialogue returns a copy of the results without the dialogue of their scripts
+func withoutDialogue(results []fgoscript.ParseResult) []fgoscript.ParseResult {
+	if results == nil {
+		return nil
+	}
+	stripped := make([]fgoscript.ParseResult, len(results))
+	for i, r := range results {
+		r.Dialogue = nil
+		r.Children = withoutDialogue(r.Children)
+		stripped[i] = r
+	}
+	return stripped
+}
+
+// countDuplicates returns the number of duplicate scripts left out across all results
+func countDuplicates(results []fgoscript.ParseResult) int {
+	duplicates := 0
+	for _, r := range results {
+		duplicates += len(r.Duplicates)
+	}
+	return duplicates
+}
+
+// countFailed returns the number of failed scripts across all results
+func countFailed(results []fgoscript.ParseResult) int {
+	failed := 0
+	for _, r := range results {
+		failed += len(r.Failed)
+	}
+	return failed
+}
+
+// incompleteError returns an error listing the failed scripts if any result is incomplete
+func incompleteError(results []fgoscript.ParseResult) error {
+	var failed []string
+	for _, r := range results {
+		for _, f := range r.Failed {
+			failed = append(failed, f.ScriptId)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("results are incomplete, %d scripts failed: %s", len(failed), strings.Join(failed, ", "))
+}
+
+// countHeader returns the given columns followed by the count column titles
+func countHeader(includeWordCount bool, columns ...string) []string {
+	columns = append(columns, "Lines", "Characters")
+	if includeWordCount {
+		columns = append(columns, "Words")
+	}
+	return columns
+}
+
+// countRow returns the given columns followed by the count values
+func countRow(c fgoscript.Count, includeWordCount bool, columns ...string) []string {
+	columns = append(columns, fmt.Sprint(c.Lines), fmt.Sprint(c.Characters))
+	if includeWordCount {
+		columns = append(columns, fmt.Sprint(c.WordCount()))
+	}
+	return columns
+}
+
+// writeResultsFile writes the results to the output file, returning its path
+func writeResultsFile(results []fgoscript.ParseResult, opts OutputOptions) (string, error) {
+	path, err := expandOutputPath(opts.Path, opts.Metadata, opts.Format)
+	if err != nil {
+		return "", err
+	}
+	if err := checkExistsPolicy(opts.IfExists, opts.Format); err != nil {
+		return "", err
+	}
+	file, path, appending, err := createOutputFile(path, opts.IfExists)
+	if err != nil {
+		return "", err
+	}
+	// The rows are added below the header that is already in the file
+	opts.NoHeader = opts.NoHeader || appending
+	// Rows appended by later runs would end up below the summary and extra tables,
+	// so an appended tsv file only ever has the header and the result rows
+	if opts.IfExists == Append && opts.Format == FormatTSV {
+		opts.NoSummary, opts.TSVSections = true, false
+	}
+	if err := WriteResults(file, results, opts); err != nil {
+		file.Close()
+		return "", fmt.Errorf("could not write output file. %s", err)
+	}
+	// Some filesystems only report a failed write when the file is closed
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("could not write output file. %s", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"strings"
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+)
+
+func TestWriteTSV(t *testing.T) {
+	results := []fgoscript.ParseResult{{
+		Id:         "100",
+		Name:       "Fuyuki",
+		Count:      fgoscript.Count{Lines: 2, Characters: 5, Speakers: map[string]fgoscript.Count{"マシュ": {Lines: 2, Characters: 5}}},
+		Failed:     []*fgoscript.ScriptError{{ScriptId: "0100000020", Err: errors.New("unexpected status 500")}},
+		Duplicates: []*fgoscript.Duplicate{{ScriptId: "0100000030", DuplicateOf: "0100000010"}},
+	}}
+
+	var b bytes.Buffer
+	if err := WriteResults(&b, results, OutputOptions{Format: FormatTSV, IncludeWordCount: true}); err != nil {
+		t.Fatal(err)
+	}
+	reader := csv.NewReader(&b)
+	reader.Comma = '\t'
+	rows, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("default tsv output isn't a single table: %s", err)
+	}
+	// Header, result, total, mean and median
+	if len(rows) != 5 {
+		t.Errorf("got %d rows, want 5", len(rows))
+	}
+
+	b.Reset()
+	if err := WriteResults(&b, results, OutputOptions{Format: FormatTSV, NoSummary: true, TSVSections: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Speaker", "マシュ", "0100000020", "0100000030"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("tsv output with sections doesn't contain %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWriteMarkdownEscapesCells(t *testing.T) {
+	results := []fgoscript.ParseResult{{
+		Id:   "100",
+		Name: "Fuyuki | Prologue",
+		Count: fgoscript.Count{Lines: 1, Characters: 2, Speakers: map[string]fgoscript.Count{
+			"A|B": {Lines: 1, Characters: 2},
+		}},
+		Children: []fgoscript.ParseResult{{Id: "1000001", Name: "Quest|1", Kind: fgoscript.KindQuest, Count: fgoscript.Count{Lines: 1, Characters: 2}}},
+	}}
+
+	var b bytes.Buffer
+	if err := WriteResults(&b, results, OutputOptions{Format: FormatMarkdown, NoSummary: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`| 100 | Fuyuki \| Prologue | 1 | 2 |`, `| 1000001 | Quest\|1 | 1 | 2 |`, `| A\|B | 1 | 2 |`} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("markdown output doesn't contain %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestIncompleteError(t *testing.T) {
+	complete := fgoscript.ParseResult{Id: "100"}
+	incomplete := fgoscript.ParseResult{Id: "101", Failed: []*fgoscript.ScriptError{
+		{ScriptId: "0101000010", Err: errors.New("unexpected status 500")},
+		{ScriptId: "0101000020", Err: errors.New("unexpected status 404")},
+	}}
+	if err := incompleteError([]fgoscript.ParseResult{complete}); err != nil {
+		t.Errorf("got error %v for complete results", err)
+	}
+	err := incompleteError([]fgoscript.ParseResult{complete, incomplete})
+	if err == nil || !strings.Contains(err.Error(), "2 scripts failed: 0101000010, 0101000020") {
+		t.Errorf("got error %v, want both failed scripts listed", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultOutputPath is the output path template used when none is configured
+const DefaultOutputPath = "script-length.{ext}"
+
+// ExistsPolicy decides what happens when the output file already exists
+type ExistsPolicy string
+
+const (
+	// Replace the existing file
+	Overwrite ExistsPolicy = "overwrite"
+	// Add the results to the end of the existing file. Only for tsv and ndjson output
+	Append ExistsPolicy = "append"
+	// Write to a new file with a numbered suffix, e.g. script-length-2.csv
+	UniqueSuffix ExistsPolicy = "unique"
+)
+
+var ExistsPolicies = []ExistsPolicy{Overwrite, Append, UniqueSuffix}
+
+// ParseExistsPolicy returns the policy for "overwrite", "append" or "unique"
+func ParseExistsPolicy(s string) (ExistsPolicy, error) {
+	i := slices.Index(ExistsPolicies, ExistsPolicy(strings.ToLower(s)))
+	if i == -1 {
+		return "", fmt.Errorf("unknown policy %q for existing output files. Must be one of overwrite, append or unique", s)
+	}
+	return ExistsPolicies[i], nil
+}
+
+// checkExistsPolicy returns an error if the policy can't be used for the output format.
+// Appending only works for formats that are a list of rows, not a single document
+func checkExistsPolicy(policy ExistsPolicy, format OutputFormat) error {
+	if policy == Append && format != FormatTSV && format != FormatNDJSON {
+		return fmt.Errorf("can't append to %s output, as the file would no longer be valid. Only tsv and ndjson output can be appended to", format)
+	}
+	return nil
+}
+
+var placeholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+// unsafePathRegex matches characters that can't be used in file names on every platform
+var unsafePathRegex = regexp.MustCompile(`[<>:"/\\|?*\s]+`)
+
+// expandOutputPath fills in the placeholders of an output path template:
+// {source}, {type}, {region}, {ids}, {date}, {time} and {ext}
+func expandOutputPath(template string, metadata Metadata, format OutputFormat) (string, error) {
+	if template == "" {
+		template = DefaultOutputPath
+	}
+
+	idType := metadata.IdType
+	if idType == "" {
+		idType = "files"
+	}
+	var ids []string
+	for _, input := range metadata.Inputs {
+		ids = append(ids, filepath.Base(filepath.Clean(input)))
+	}
+	created := metadata.CreatedAt.Local()
+	values := map[string]string{
+		"{source}": metadata.Source,
+		"{type}":   idType,
+		"{region}": string(metadata.Region),
+		"{ids}":    truncateIds(unsafePathRegex.ReplaceAllString(strings.Join(ids, "_"), "_")),
+		"{date}":   created.Format("2006-01-02"),
+		"{time}":   created.Format("150405"),
+		"{ext}":    strings.TrimPrefix(format.extension(), "."),
+	}
+
+	var unknown []string
+	path := placeholderRegex.ReplaceAllStringFunc(template, func(placeholder string) string {
+		value, found := values[placeholder]
+		if !found {
+			unknown = append(unknown, placeholder)
+			return placeholder
+		}
+		return value
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholder %s in output path. Must be one of {source}, {type}, {region}, {ids}, {date}, {time} or {ext}", strings.Join(unknown, ", "))
+	}
+	return path, nil
+}
+
+// truncateIds keeps the {ids} placeholder from making file names too long.
+// It counts characters rather than bytes, so names in any script are cut between characters
+func truncateIds(ids string) string {
+	const maxLength = 64
+	runes := []rune(ids)
+	if len(runes) <= maxLength {
+		return ids
+	}
+	return string(runes[:maxLength])
+}
+
+// createOutputFile creates the file at path, along with any missing parent
+// directories, and returns it with the path that was actually used. It also
+// reports whether the file already has contents that are being appended to
+func createOutputFile(path string, policy ExistsPolicy) (*os.File, string, bool, error) {
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, "", false, fmt.Errorf("could not create output directory. %s", err)
+		}
+	}
+
+	switch policy {
+	case Append:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, "", false, fmt.Errorf("could not open output file. %s", err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, "", false, fmt.Errorf("could not open output file. %s", err)
+		}
+		return file, path, info.Size() > 0, nil
+	case UniqueSuffix:
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		candidate := path
+		for i := 2; ; i++ {
+			file, err := os.OpenFile(candidate, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			if err == nil {
+				return file, candidate, false, nil
+			} else if !errors.Is(err, fs.ErrExist) {
+				return nil, "", false, fmt.Errorf("could not create output file. %s", err)
+			}
+			candidate = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("could not create output file. %s", err)
+	}
+	return file, path, false, nil
+}
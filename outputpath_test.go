@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"fgo-script-parser/fgoscript"
+)
+
+func TestTruncateIds(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  string
+		want int
+	}{
+		{"short", "100_101", 7},
+		{"ascii", strings.Repeat("1", 100), 64},
+		{"japanese", strings.Repeat("冬木", 40), 64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateIds(tt.ids)
+			if !utf8.ValidString(got) || utf8.RuneCountInString(got) != tt.want {
+				t.Errorf("truncateIds(%q) = %q, want %d valid characters", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteResultsFileAppend(t *testing.T) {
+	results := []fgoscript.ParseResult{{Id: "100", Name: "Fuyuki", Count: fgoscript.Count{Lines: 2, Characters: 5}}}
+	path := filepath.Join(t.TempDir(), "out.{ext}")
+
+	for _, format := range []OutputFormat{FormatJSON, FormatMarkdown, FormatHTML} {
+		opts := OutputOptions{Format: format, Path: path, IfExists: Append}
+		if _, err := writeResultsFile(results, opts); err == nil {
+			t.Errorf("appending to %s output didn't fail", format)
+		}
+	}
+
+	// The summary and extra tables are left out, so later rows aren't written below them
+	opts := OutputOptions{Format: FormatTSV, TSVSections: true, Path: path, IfExists: Append}
+	for range 2 {
+		if _, err := writeResultsFile(results, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(strings.Replace(path, "{ext}", "csv", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Id\tName\tLines\tCharacters\n100\tFuyuki\t2\t5\n100\tFuyuki\t2\t5\n"; string(data) != want {
+		t.Errorf("got file\n%s\nwant one header followed by both rows", data)
+	}
+}
+
+func TestReadAppendedNDJSON(t *testing.T) {
+	results := []fgoscript.ParseResult{{Id: "100", Name: "Fuyuki", Kind: fgoscript.KindWar, Count: fgoscript.Count{Lines: 2, Characters: 5}}}
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	opts := OutputOptions{Format: FormatNDJSON, Path: path, IfExists: Append, Metadata: newMetadata(fgoscript.RegionJP, atlas, fgoscript.IdTypeWar, []string{"100"})}
+
+	if _, err := writeResultsFile(results, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, read, err := readNDJSONResults(path); err != nil || len(read) != 1 {
+		t.Fatalf("got %d results and error %v from a single run", len(read), err)
+	}
+
+	if _, err := writeResultsFile(results, opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readNDJSONResults(path); err == nil || !strings.Contains(err.Error(), "more than one run") {
+		t.Errorf("got error %v, want the appended runs rejected", err)
+	}
+}
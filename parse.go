@@ -1,378 +1,269 @@
 package main
 
 import (
-	"encoding/csv"
+	"context"
 	"errors"
 	"fmt"
-	"io/fs"
-	"os"
-	"path/filepath"
-	"regexp"
 	"strings"
-	"sync"
+
+	"fgo-script-parser/fgoscript"
 
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/go-zoox/fetch"
-	"golang.org/x/exp/slices"
 )
 
-type ParseResult struct {
-	id    string
-	name  string
-	count Count
-}
-
-type parseSuccessMsg []ParseResult
-
-type parseFailureMsg error
-
-type Script struct {
-	ScriptId string `json:"scriptId"`
-	Script   string `json:"script"`
+// Every parse message carries the id of the run it belongs to, so that
+// messages from a cancelled run can be ignored
+
+type parseSuccessMsg struct {
+	id         int
+	results    []fgoscript.ParseResult
+	metadata   Metadata
+	outputPath string
+	// ID of the run in the history, if it was recorded
+	runId      int64
+	cacheStats fgoscript.CacheStats
+	// Number of duplicate scripts left out of the counts
+	duplicates int
+	// Set if any result is incomplete
+	err error
+	// Set if the run couldn't be recorded in the history. The results are kept
+	// and this is only shown as a warning, like on the command line
+	recordErr error
 }
 
-type Quest struct {
-	Name         string `json:"name"`
-	Id           int    `json:"id"`
-	Type         string `json:"type"`
-	PhaseScripts []struct {
-		Phase   int `json:"phase"`
-		Scripts []Script
-	}
+type parseFailureMsg struct {
+	id  int
+	err error
 }
 
-type Response struct {
-	Name     string `json:"name"`
-	LongName string `json:"longName"`
-	Spots    []struct {
-		Quests []Quest
-	}
+type parseProgressMsg struct {
+	id       int
+	progress fgoscript.Progress
 }
 
-type Count struct {
-	lines      int
-	characters int
+type parseCancelledMsg struct {
+	id int
+	// Results completed before the run was cancelled
+	results  []fgoscript.ParseResult
+	metadata Metadata
 }
 
-func (m Model) parseScriptCmd() tea.Cmd {
+func (m Model) parseScriptCmd(ctx context.Context, id int, progress chan fgoscript.Progress) tea.Cmd {
 	return func() tea.Msg {
-		var results []ParseResult
+		defer close(progress)
+		var results []fgoscript.ParseResult
 		var err error
-		if strings.TrimSpace(m.IdInput.Value()) == "" {
-			return parseFailureMsg(errors.New("IDs cannot be empty"))
+		input := splitInput(m.IdInput.Value())
+		pickedCollection := m.collection != nil && m.selectedSource == atlas
+		if len(input) == 0 && !pickedCollection {
+			return parseFailureMsg{id, errors.New("IDs cannot be empty")}
 		}
 
-		switch m.selectedSource {
-		case atlas:
-			results, err = m.ParseFromAtlas()
-		case local:
-			results, err = m.ParseFromLocal()
+		metadata := newMetadata(m.options.region, m.selectedSource, m.selectedAtlasIdType, input)
+		client := m.config.client(m.options.region)
+		if client.Cache != nil {
+			client.Cache.Offline = m.options.offline
 		}
-		if err != nil {
-			return parseFailureMsg(err)
+		client.KeepDialogue = m.config.Dialogue || m.options.record
+		client.KeepDuplicates = m.options.keepDuplicates
+		client.Names = m.options.names
+		client.OnProgress = func(p fgoscript.Progress) {
+			// Only the latest progress matters, so replace any that hasn't been read yet
+			select {
+			case <-progress:
+			default:
+			}
+			progress <- p
+		}
+		switch {
+		case pickedCollection:
+			metadata, results, err = parseCollection(ctx, client, *m.collection)
+		case m.selectedSource == atlas:
+			results, err = client.ParseFromAtlas(ctx, input, m.selectedAtlasIdType)
+		case m.selectedSource == local:
+			results, err = client.ParseFromLocal(ctx, input)
+		}
+		if ctx.Err() != nil {
+			return parseCancelledMsg{id, results, metadata}
+		} else if err != nil {
+			return parseFailureMsg{id, err}
 		}
 
-		var writer *csv.Writer
+		msg := parseSuccessMsg{id: id, results: results, metadata: metadata}
 		if !m.options.noFile {
-			file, err := CreateFile()
+			msg.outputPath, err = writeResultsFile(m.options.sort.Apply(results), m.outputOptions(metadata))
 			if err != nil {
-				return parseFailureMsg(err)
+				return parseFailureMsg{id, err}
 			}
-			writer = csv.NewWriter(file)
-		} else {
-			writer = csv.NewWriter(os.Stdout)
 		}
-		writer.Comma = '\t'
-
-		// TODO: Don't include ID for local parsing
-		if m.options.includeWordCount {
-			writer.Write([]string{"Id", "Name", "Lines", "Characters, Words"})
-			for _, r := range results {
-				writer.Write([]string{r.id, r.name, fmt.Sprint(r.count.lines), fmt.Sprint(r.count.characters), fmt.Sprint(r.count.characters / 2)})
-			}
-		} else {
-			writer.Write([]string{"Id", "Name", "Lines", "Characters"})
-			for _, r := range results {
-				writer.Write([]string{r.id, r.name, fmt.Sprint(r.count.lines), fmt.Sprint(r.count.characters)})
-			}
+		if m.options.record {
+			msg.runId, msg.recordErr = recordRun(ctx, m.config.History, metadata, results)
 		}
-
-		if !m.options.noFile {
-			writer.Flush()
+		msg.duplicates = countDuplicates(results)
+		if failed := countFailed(results); failed > 0 {
+			msg.err = fmt.Errorf("results are incomplete, %d scripts failed. Incomplete rows are marked with ⚠", failed)
+		}
+		if client.Cache != nil {
+			msg.cacheStats = client.Cache.Stats()
 		}
-		return parseSuccessMsg(results)
+		return msg
 	}
 }
 
-func (m Model) ParseFromAtlas() ([]ParseResult, error) {
-	var results []ParseResult
+type scriptLoadedMsg struct {
+	result fgoscript.ParseResult
+	lines  []fgoscript.AnnotatedLine
+}
 
-	scripts := make(map[string]Script)
-	for id := range strings.SplitSeq(m.IdInput.Value(), "\n") {
-		// Skip empty rows
-		if strings.Trim(id, " ") == "" {
-			continue
+// loadScriptCmd fetches the source of a script result and annotates it for the script viewer
+func (m Model) loadScriptCmd(result fgoscript.ParseResult) tea.Cmd {
+	return func() tea.Msg {
+		client := m.config.client(m.options.region)
+		if client.Cache != nil {
+			client.Cache.Offline = m.options.offline
 		}
-
-		switch m.selectedAtlasIdType {
-		case war:
-			s, name, err := FetchWarScripts(id)
-			if err != nil {
-				return nil, err
-			}
-			for _, script := range s {
-				scripts[script.ScriptId] = script
-			}
-			// The quest list for OC2 does not include the appendix
-			if id == "403" {
-				s, _, err = FetchQuestScripts("4000327")
-				if err != nil {
-					return nil, err
-				}
-				for _, script := range s {
-					scripts[script.ScriptId] = script
-				}
-			}
-
-			var scr []Script
-			for _, v := range scripts {
-				scr = append(scr, v)
-			}
-			result, err := ParseScripts(scr, name)
-			if err != nil {
-				return nil, err
-			}
-			result.id = id
-			results = append(results, result)
-		case quest:
-			s, name, err := FetchQuestScripts(id)
-			if err != nil {
-				return nil, err
-			}
-			for _, script := range s {
-				scripts[script.ScriptId] = script
-			}
-
-			var scr []Script
-			for _, v := range scripts {
-				scr = append(scr, v)
-			}
-			result, err := ParseScripts(scr, name)
-			if err != nil {
-				return nil, err
-			}
-			result.id = id
-			results = append(results, result)
-		case script:
-			result, err := FetchSingleScript(id)
-			if err != nil {
-				return nil, err
-			}
-			result.id = id
-			results = append(results, result)
+		data, err := client.FetchSource(context.Background(), result)
+		if err != nil {
+			return errMsg(err)
 		}
+		return scriptLoadedMsg{result, fgoscript.AnnotateScript(data, m.options.region.CountMode())}
 	}
-
-	return results, nil
 }
 
-func (m Model) ParseFromLocal() ([]ParseResult, error) {
-	var results []ParseResult
-
-	for path := range strings.SplitSeq(m.IdInput.Value(), "\n") {
-		// Get rid of empty rows
-		if strings.Trim(path, " ") == "" {
-			continue
-		}
-		path = strings.Trim(path, "\"")
-		argInfo, err := os.Stat(path)
-		if err != nil {
-			return nil, parseFailureMsg(fmt.Errorf("could not get file info for %s. %s", path, err))
+// waitForProgress waits for the next progress update of a run.
+// It returns nil once the run is over and the channel is closed.
+func waitForProgress(id int, progress chan fgoscript.Progress) tea.Cmd {
+	return func() tea.Msg {
+		p, ok := <-progress
+		if !ok {
+			return nil
 		}
+		return parseProgressMsg{id, p}
+	}
+}
 
-		// If given path is a file, just open and count it, else traverse the directory
-		if argInfo.IsDir() {
-			TraverseDirectories(path, &results)
-		} else {
-			data, err := os.ReadFile(path)
-			if err != nil {
-				return nil, parseFailureMsg(fmt.Errorf("can't read file: %s. %s", path, err))
-			}
-			count := CleanAndCountScript(string(data))
-			results = append(results, ParseResult{
-				name:  strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)),
-				count: count,
-			})
+// splitInput splits the ID/path input into one entry per line, skipping empty rows
+func splitInput(input string) []string {
+	var entries []string
+	for entry := range strings.SplitSeq(input, "\n") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
 		}
+		entries = append(entries, entry)
 	}
-
-	return results, nil
+	return entries
 }
 
-func CreateFile() (*os.File, error) {
-	file, err := os.Create("script-length.csv")
+// exportResultsCmd writes the results to the output file in the order they are shown
+func (m Model) exportResultsCmd() tea.Msg {
+	path, err := writeResultsFile(m.shownResults, m.outputOptions(m.runMetadata))
 	if err != nil {
-		return nil, parseFailureMsg(fmt.Errorf("could not create output file. %s", err))
+		return errMsg(err)
 	}
-	return file, nil
+	return notificationMsg{message: "Results exported to " + path}
 }
 
-func ParseScripts(scripts []Script, name string) (ParseResult, error) {
-	lines := 0
-	characters := 0
-	ch := make(chan Count, len(scripts))
-	wg := sync.WaitGroup{}
-	for _, script := range scripts {
-		wg.Add(1)
-		go func(script Script) {
-			// TODO: Handle error
-			r, _ := fetch.Get(script.Script)
-			count := CleanAndCountScript(r.String())
-			ch <- count
-			wg.Done()
-		}(script)
+func (m Model) clearCacheCmd() tea.Msg {
+	cache := m.config.cache()
+	if cache == nil {
+		return errMsg(errors.New("the cache is disabled"))
 	}
-	wg.Wait()
-	close(ch)
-
-	for c := range ch {
-		lines += c.lines
-		characters += c.characters
+	if err := cache.Clear(); err != nil {
+		return errMsg(err)
 	}
-
-	return ParseResult{
-		name: name,
-		count: Count{
-			lines:      lines,
-			characters: characters,
-		},
-	}, nil
+	return notificationMsg{message: "Cache cleared!"}
 }
 
-func FetchWarScripts(id string) ([]Script, string, error) {
-	var result Response
-	response, err := fetch.Get(fmt.Sprintf("https://api.atlasacademy.io/nice/JP/war/%s?lang=en", id))
-	if response.StatusCode() == 404 {
-		return nil, "", parseFailureMsg(fmt.Errorf("could not get data for war with ID %s. Make sure the ID is correct", id))
-	} else if err != nil {
-		return nil, "", parseFailureMsg(fmt.Errorf("could not get data for war with ID %s. %s", id, err))
-	}
-	err = response.UnmarshalJSON(&result)
-	if err != nil {
-		return nil, "", parseFailureMsg(fmt.Errorf("error unmarshaling JSON: %s", err))
-	}
-
-	var scripts []Script
-	for _, spot := range result.Spots {
-		for _, quest := range spot.Quests {
-			// This works for both main story and event quests
-			if quest.Type == "main" {
-				for _, phase := range quest.PhaseScripts {
-					scripts = append(scripts, phase.Scripts...)
-				}
-			}
-		}
-	}
-	// TODO: Might be needed for the other fetching functions as well
-	name := result.Name
-	if result.Name == "-" {
-		name = result.LongName
-	}
-	return scripts, name, nil
+type historyLoadedMsg struct {
+	runs []StoredRun
 }
 
-func FetchQuestScripts(id string) ([]Script, string, error) {
-	var result Quest
-	response, err := fetch.Get(fmt.Sprintf("https://api.atlasacademy.io/nice/JP/quest/%s?lang=en", id))
-	if response.StatusCode() == 404 {
-		return nil, "", parseFailureMsg(fmt.Errorf("could not get data for quest with ID %s. Make sure the ID is correct", id))
-	} else if err != nil {
-		return nil, "", parseFailureMsg(fmt.Errorf("could not get data for quest with ID %s. %s", id, err))
-	}
-	err = response.UnmarshalJSON(&result)
-	if err != nil {
-		return nil, "", parseFailureMsg(fmt.Errorf("error unmarshaling JSON: %s", err))
-	}
+type runLoadedMsg struct {
+	id       int64
+	metadata Metadata
+	results  []fgoscript.ParseResult
+}
 
-	var scripts []Script
-	for _, phase := range result.PhaseScripts {
-		scripts = append(scripts, phase.Scripts...)
-	}
+type runDeletedMsg struct {
+	id int64
+}
 
-	return scripts, result.Name, nil
+type compareLoadedMsg struct {
+	oldId, newId int64
+	diff         Diff
 }
 
-func FetchSingleScript(id string) (ParseResult, error) {
-	response, err := fetch.Get(fmt.Sprintf("https://static.atlasacademy.io/JP/Script/%s/%s.txt", id[0:2], id))
-	if response.StatusCode() == 404 {
-		return ParseResult{}, parseFailureMsg(fmt.Errorf("error fetching script %s. Make sure the ID is correct", id))
-	} else if err != nil {
-		return ParseResult{}, parseFailureMsg(fmt.Errorf("error fetching script %s. %s", id, err))
+// recordRun saves a run in the history database at path and returns its ID
+func recordRun(ctx context.Context, path string, metadata Metadata, results []fgoscript.ParseResult) (int64, error) {
+	store, err := OpenStore(path)
+	if err != nil {
+		return 0, err
 	}
-	count := CleanAndCountScript(response.String())
-
-	return ParseResult{
-		name:  id,
-		count: count,
-	}, nil
+	defer store.Close()
+	return store.SaveRun(ctx, metadata, results)
 }
 
-func TraverseDirectories(path string, results *[]ParseResult) error {
-	entries, err := os.ReadDir(path)
+// loadHistoryCmd reads the list of recorded runs
+func (m Model) loadHistoryCmd() tea.Msg {
+	store, err := OpenStore(m.config.History)
 	if err != nil {
-		return parseFailureMsg(fmt.Errorf("unable to get entries for directory %s", path))
+		return errMsg(err)
 	}
-
-	hasDirectory := slices.ContainsFunc(entries, func(e fs.DirEntry) bool {
-		return e.IsDir()
-	})
-
-	// If directories exist, call this recursively for each one until we hit the lowest level
-	if hasDirectory {
-		for _, e := range entries {
-			err = TraverseDirectories(filepath.Join(path, e.Name()), results)
-			if err != nil {
-				break
-			}
-		}
-		return err
+	defer store.Close()
+	runs, err := store.Runs(context.Background())
+	if err != nil {
+		return errMsg(err)
 	}
+	return historyLoadedMsg{runs}
+}
 
-	lines := 0
-	characters := 0
-	// This could be done with goroutines but it's pretty fast already
-	for _, e := range entries {
-		data, err := os.ReadFile(filepath.Join(path, e.Name()))
+// loadRunCmd reads the results of a recorded run to reopen them in the results table
+func (m Model) loadRunCmd(id int64) tea.Cmd {
+	return func() tea.Msg {
+		store, err := OpenStore(m.config.History)
+		if err != nil {
+			return errMsg(err)
+		}
+		defer store.Close()
+		metadata, results, err := store.LoadRun(context.Background(), id)
 		if err != nil {
-			return parseFailureMsg(fmt.Errorf("can't read file: %s", filepath.Join(path, e.Name())))
+			return errMsg(err)
 		}
-		count := CleanAndCountScript(string(data))
-		lines += count.lines
-		characters += count.characters
+		return runLoadedMsg{id, metadata, results}
 	}
-	*results = append(*results, ParseResult{
-		name: filepath.Base(path),
-		count: Count{
-			lines:      lines,
-			characters: characters,
-		},
-	})
-
-	return nil
 }
 
-func CleanAndCountScript(data string) Count {
-	r, _ := regexp.Compile(`(＠([A-Z][：:])?(.*)\n)(.*?\n(?:.*?\n)?)?(.*?)\n\[k\]|(？.+?：.+)`)
-	matches := r.FindAllString(data, -1)
-	lines := len(matches)
-	characters := 0
-	r, _ = regexp.Compile(`(\[[^#&]+?\]|[\[\]#&:]|？.+?：|^＠.+|\n)`)
-	for _, m := range matches {
-		characters += len([]rune(r.ReplaceAllString(m, "")))
+func (m Model) deleteRunCmd(id int64) tea.Cmd {
+	return func() tea.Msg {
+		store, err := OpenStore(m.config.History)
+		if err != nil {
+			return errMsg(err)
+		}
+		defer store.Close()
+		if err := store.DeleteRun(context.Background(), id); err != nil {
+			return errMsg(err)
+		}
+		return runDeletedMsg{id}
 	}
+}
 
-	return Count{
-		lines:      lines,
-		characters: characters,
+// compareRunsCmd compares two recorded runs
+func (m Model) compareRunsCmd(oldId, newId int64) tea.Cmd {
+	return func() tea.Msg {
+		store, err := OpenStore(m.config.History)
+		if err != nil {
+			return errMsg(err)
+		}
+		defer store.Close()
+		oldMetadata, oldResults, err := store.LoadRun(context.Background(), oldId)
+		if err != nil {
+			return errMsg(err)
+		}
+		newMetadata, newResults, err := store.LoadRun(context.Background(), newId)
+		if err != nil {
+			return errMsg(err)
+		}
+		return compareLoadedMsg{oldId, newId, newDiff(oldMetadata, newMetadata, oldResults, newResults)}
 	}
 }
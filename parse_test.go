@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestParseKeepsResultsWhenRecordingFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "0100000010.txt")
+	if err := os.WriteFile(path, []byte("＠A：マシュ\n先輩！\n[k]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The history can't be created inside a file
+	config := Config{History: filepath.Join(path, "history.db")}
+	m := NewModel(config, Options{noFile: true, record: true, region: fgoscript.RegionJP})
+	m.selectedSource = local
+	m.IdInput.SetValue(path)
+	m.parseId = 1
+
+	msg := m.parseScriptCmd(context.Background(), 1, make(chan fgoscript.Progress, 1))()
+	success, ok := msg.(parseSuccessMsg)
+	if !ok {
+		t.Fatalf("got %T, want the results despite the history error", msg)
+	}
+	if success.recordErr == nil || success.runId != 0 {
+		t.Errorf("got run %d and record error %v, want only the error", success.runId, success.recordErr)
+	}
+
+	updated, _ := m.Update(success)
+	m = updated.(Model)
+	if m.currentState != Results || len(m.results) != 1 || m.results[0].Count.Lines != 1 {
+		t.Errorf("got state %d with results %+v, want the results screen", m.currentState, m.results)
+	}
+	if m.err == nil || !strings.Contains(m.err.Error(), "not recorded") {
+		t.Errorf("got error %v, want a warning that the run wasn't recorded", m.err)
+	}
+}
+
+func TestCancelParse(t *testing.T) {
+	m := NewModel(Config{}, Options{keepPartial: true})
+	cancelled := false
+	m.cancelParse = func() { cancelled = true }
+	m.currentState = Parsing
+	m.parseId = 2
+	m.updateKeymap()
+
+	updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = updated.(Model)
+	if !cancelled || m.currentState != Confirm {
+		t.Fatalf("got state %d and cancelled %t, want the run cancelled and the confirm step shown", m.currentState, cancelled)
+	}
+
+	partial := []fgoscript.ParseResult{{Id: "100", Name: "Fuyuki"}}
+	// A message from an earlier run is ignored
+	updated, _ = m.Update(parseCancelledMsg{id: 1, results: partial})
+	if m = updated.(Model); len(m.results) != 0 {
+		t.Errorf("got results %+v from an earlier run", m.results)
+	}
+	updated, _ = m.Update(parseCancelledMsg{id: 2, results: partial})
+	if m = updated.(Model); len(m.results) != 1 {
+		t.Errorf("got results %+v, want the partial results kept", m.results)
+	}
+}
+
+func TestParseProgress(t *testing.T) {
+	m := NewModel(Config{}, Options{})
+	m.currentState = Parsing
+	m.parseId = 2
+	m.progressCh = make(chan fgoscript.Progress, 1)
+
+	progress := fgoscript.Progress{Scripts: fgoscript.ProgressCount{Done: 1, Total: 3}, Current: "script 0100000010"}
+	updated, _ := m.Update(parseProgressMsg{id: 1, progress: progress})
+	if m = updated.(Model); m.progress != (fgoscript.Progress{}) {
+		t.Errorf("got progress %+v from an earlier run", m.progress)
+	}
+	updated, _ = m.Update(parseProgressMsg{id: 2, progress: progress})
+	if m = updated.(Model); m.progress != progress {
+		t.Errorf("got progress %+v, want %+v", m.progress, progress)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"fgo-script-parser/fgoscript"
+)
+
+//go:embed templates
+var reportTemplates embed.FS
+
+// reportData is what report templates are executed with
+type reportData struct {
+	Metadata         Metadata
+	Results          []reportResult
+	Summary          *Summary
+	IncludeWordCount bool
+	// Speakers across every result
+	Speakers []reportSpeaker
+}
+
+// reportResult is a result along with its per-speaker breakdown
+type reportResult struct {
+	fgoscript.ParseResult
+	// Position in the results, e.g. to link to the result's section
+	Index    int
+	Speakers []reportSpeaker
+}
+
+// reportSpeaker is a speaker's count, with their share of the characters
+// relative to the speaker with the most characters, from 0 to 1
+type reportSpeaker struct {
+	fgoscript.SpeakerCount
+	Share float64
+}
+
+var reportFuncs = map[string]any{
+	"join":  strings.Join,
+	"words": fgoscript.Count.WordCount,
+	// percent formats a share as a percentage for HTML bar widths
+	"percent": func(share float64) string {
+		return fmt.Sprintf("%.1f", share*100)
+	},
+	// bar draws a share as a text bar of up to width blocks
+	"bar": func(share float64, width int) string {
+		return strings.Repeat("█", int(share*float64(width)+0.5))
+	},
+	// cell escapes text for a Markdown table cell, so a | or line break in a name doesn't split the row
+	"cell": markdownCellReplacer.Replace,
+}
+
+var markdownCellReplacer = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ")
+
+// writeReport renders the results as a Markdown or HTML report using the
+// embedded template for the format, or the template file set in opts
+func writeReport(w io.Writer, results []fgoscript.ParseResult, opts OutputOptions) error {
+	data := reportData{
+		Metadata:         opts.Metadata,
+		IncludeWordCount: opts.IncludeWordCount,
+	}
+	var total fgoscript.Count
+	for i, r := range results {
+		data.Results = append(data.Results, reportResult{ParseResult: r, Index: i, Speakers: reportSpeakers(r.Count)})
+		total = total.Add(r.Count)
+	}
+	data.Speakers = reportSpeakers(total)
+	if !opts.NoSummary && len(results) > 0 {
+		summary := Summarize(results)
+		data.Summary = &summary
+	}
+
+	name := "report.md.tmpl"
+	if opts.Format == FormatHTML {
+		name = "report.html.tmpl"
+	}
+	source, err := reportTemplates.ReadFile("templates/" + name)
+	if opts.Template != "" {
+		name = filepath.Base(opts.Template)
+		source, err = os.ReadFile(opts.Template)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read report template. %s", err)
+	}
+
+	if opts.Format == FormatHTML {
+		tmpl, err := htmltemplate.New(name).Funcs(reportFuncs).Parse(string(source))
+		if err != nil {
+			return fmt.Errorf("could not parse report template. %s", err)
+		}
+		return tmpl.Execute(w, data)
+	}
+	tmpl, err := texttemplate.New(name).Funcs(reportFuncs).Parse(string(source))
+	if err != nil {
+		return fmt.Errorf("could not parse report template. %s", err)
+	}
+	return tmpl.Execute(w, data)
+}
+
+// reportSpeakers returns the speakers of a count, with the most characters first
+func reportSpeakers(c fgoscript.Count) []reportSpeaker {
+	speakers := c.SortedSpeakers()
+	most := 0
+	if len(speakers) > 0 {
+		most = speakers[0].Characters
+	}
+
+	var shares []reportSpeaker
+	for _, s := range speakers {
+		share := 0.0
+		if most > 0 {
+			share = float64(s.Characters) / float64(most)
+		}
+		shares = append(shares, reportSpeaker{SpeakerCount: s, Share: share})
+	}
+	return shares
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestOpenResult(t *testing.T) {
+	phase := fgoscript.ParseResult{Id: "1", Name: "Phase 1", Kind: fgoscript.KindPhase, Children: []fgoscript.ParseResult{
+		{Id: "0101000010", Name: "0101000010", Kind: fgoscript.KindScript},
+	}}
+	results := []fgoscript.ParseResult{
+		{Id: "100", Name: "Fuyuki", Kind: fgoscript.KindWar},
+		{Id: "101", Name: "Orleans", Kind: fgoscript.KindWar, Children: []fgoscript.ParseResult{
+			{Id: "1000101", Name: "Quest 1", Kind: fgoscript.KindQuest, Children: []fgoscript.ParseResult{phase}},
+			{Id: "1000102", Name: "Quest 2", Kind: fgoscript.KindQuest},
+		}},
+	}
+	m := NewModel(Config{}, Options{})
+	updated, _ := m.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	m = updated.(Model)
+	m.currentState = Results
+	m.setResults(results)
+
+	press := func(msg tea.KeyMsg) {
+		m.updateKeymap()
+		updated, _ := m.Update(msg)
+		m = updated.(Model)
+	}
+	enter, back := tea.KeyMsg{Type: tea.KeyEnter}, tea.KeyMsg{Type: tea.KeyShiftTab}
+
+	// Fuyuki has nothing to open
+	press(enter)
+	if len(m.resultPath) != 0 {
+		t.Fatalf("opened %v, want results without children left closed", m.resultPath)
+	}
+	press(tea.KeyMsg{Type: tea.KeyDown})
+	press(enter)
+	press(enter)
+	if len(m.resultPath) != 2 || m.resultPath[1].Name != "Quest 1" {
+		t.Fatalf("got path %v, want Orleans and Quest 1", m.resultPath)
+	}
+	if got := resultIds(m.shownResults); !slices.Equal(got, []string{"1"}) {
+		t.Errorf("got rows %v, want the phases of Quest 1", got)
+	}
+
+	press(back)
+	press(back)
+	if len(m.resultPath) != 0 || m.currentState != Results {
+		t.Fatalf("got path %v in state %d, want the top level of the results", m.resultPath, m.currentState)
+	}
+	// The result that was open is selected again
+	if cursor := m.resultsTable.Cursor(); m.shownResults[cursor].Name != "Orleans" {
+		t.Errorf("got %s selected, want Orleans", m.shownResults[cursor].Name)
+	}
+	press(back)
+	if m.currentState != Confirm {
+		t.Errorf("got state %d, want the confirm step after leaving the top level", m.currentState)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fgo-script-parser/fgoscript"
+)
+
+type SortColumn int
+
+const (
+	// Results are kept in the order they were parsed
+	SortNone SortColumn = iota
+	SortId
+	SortName
+	SortLines
+	SortCharacters
+	SortWords
+)
+
+var sortColumnNames = []string{"none", "id", "name", "lines", "characters", "words"}
+
+func (c SortColumn) String() string {
+	return sortColumnNames[c]
+}
+
+// ParseSortColumn returns the sort column matching the given name
+func ParseSortColumn(name string) (SortColumn, error) {
+	i := slices.Index(sortColumnNames, strings.ToLower(name))
+	if i == -1 {
+		return SortNone, fmt.Errorf("unknown sort column %q, must be one of %s", name, strings.Join(sortColumnNames, ", "))
+	}
+	return SortColumn(i), nil
+}
+
+// Sort is the order results are shown and written in
+type Sort struct {
+	Column     SortColumn
+	Descending bool
+}
+
+// Apply returns a sorted copy of the results. Equal results keep their parse order
+func (s Sort) Apply(results []fgoscript.ParseResult) []fgoscript.ParseResult {
+	sorted := slices.Clone(results)
+	if s.Column == SortNone {
+		return sorted
+	}
+	slices.SortStableFunc(sorted, func(a, b fgoscript.ParseResult) int {
+		c := s.compare(a, b)
+		if s.Descending {
+			return -c
+		}
+		return c
+	})
+	return sorted
+}
+
+func (s Sort) compare(a, b fgoscript.ParseResult) int {
+	switch s.Column {
+	case SortId:
+		return compareIds(a.Id, b.Id)
+	case SortName:
+		return cmp.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case SortLines:
+		return cmp.Compare(a.Count.Lines, b.Count.Lines)
+	case SortCharacters:
+		return cmp.Compare(a.Count.Characters, b.Count.Characters)
+	case SortWords:
+		return cmp.Compare(a.Count.WordCount(), b.Count.WordCount())
+	}
+	return 0
+}
+
+// Next returns the sort after selecting a column. Selecting the sorted column
+// again switches it to descending, and then back to parse order
+func (s Sort) Next(column SortColumn) Sort {
+	switch {
+	case s.Column != column:
+		return Sort{Column: column}
+	case !s.Descending:
+		return Sort{Column: column, Descending: true}
+	default:
+		return Sort{}
+	}
+}
+
+// indicator returns the arrow shown next to the title of the sorted column
+func (s Sort) indicator(column SortColumn) string {
+	if s.Column == SortNone || s.Column != column {
+		return ""
+	}
+	if s.Descending {
+		return " ▼"
+	}
+	return " ▲"
+}
+
+// compareIds compares numeric IDs by value, and anything else (such as local paths) as text
+func compareIds(a, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	if errA == nil && errB == nil {
+		return cmp.Compare(x, y)
+	}
+	return cmp.Compare(a, b)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func sortTestResults() []fgoscript.ParseResult {
+	return []fgoscript.ParseResult{
+		{Id: "102", Name: "Septem", Count: fgoscript.Count{Lines: 30, Characters: 300}},
+		{Id: "20", Name: "fuyuki", Count: fgoscript.Count{Lines: 10, Characters: 500}},
+		{Id: "101", Name: "Orleans", Count: fgoscript.Count{Lines: 30, Characters: 100, Words: 60}},
+	}
+}
+
+func resultIds(results []fgoscript.ParseResult) []string {
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.Id)
+	}
+	return ids
+}
+
+func TestSortApply(t *testing.T) {
+	tests := []struct {
+		sort Sort
+		want []string
+	}{
+		{Sort{}, []string{"102", "20", "101"}},
+		// IDs are compared as numbers
+		{Sort{Column: SortId}, []string{"20", "101", "102"}},
+		{Sort{Column: SortName}, []string{"20", "101", "102"}},
+		// Equal counts keep their parse order, in either direction
+		{Sort{Column: SortLines}, []string{"20", "102", "101"}},
+		{Sort{Column: SortLines, Descending: true}, []string{"102", "101", "20"}},
+		{Sort{Column: SortCharacters, Descending: true}, []string{"20", "102", "101"}},
+		// Counted words are used if there are any, and half the characters otherwise
+		{Sort{Column: SortWords}, []string{"101", "102", "20"}},
+	}
+	for _, tt := range tests {
+		results := sortTestResults()
+		if got := resultIds(tt.sort.Apply(results)); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.sort, got, tt.want)
+		}
+		if got := resultIds(results); !slices.Equal(got, []string{"102", "20", "101"}) {
+			t.Errorf("%+v: sorting changed the original order to %v", tt.sort, got)
+		}
+	}
+}
+
+func TestSortNext(t *testing.T) {
+	s := Sort{}
+	var got []Sort
+	for range 3 {
+		s = s.Next(SortLines)
+		got = append(got, s)
+	}
+	want := []Sort{{Column: SortLines}, {Column: SortLines, Descending: true}, {}}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v selecting a column three times, want %v", got, want)
+	}
+	if next := (Sort{Column: SortLines, Descending: true}).Next(SortName); next != (Sort{Column: SortName}) {
+		t.Errorf("got %+v selecting another column, want it ascending", next)
+	}
+}
+
+func TestParseSortColumn(t *testing.T) {
+	if column, err := ParseSortColumn("Characters"); err != nil || column != SortCharacters {
+		t.Errorf("got %v, %v, want the characters column", column, err)
+	}
+	if _, err := ParseSortColumn("speakers"); err == nil {
+		t.Error("got no error for an unknown column")
+	}
+}
+
+func TestSortResultsTable(t *testing.T) {
+	m := NewModel(Config{}, Options{})
+	m.currentState = Results
+	m.setResults(sortTestResults())
+	m.updateKeymap()
+
+	// Key 3 is the lines column
+	for _, want := range [][]string{{"20", "102", "101"}, {"102", "101", "20"}, {"102", "20", "101"}} {
+		updated, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("3")})
+		m = updated.(Model)
+		if got := resultIds(m.shownResults); !slices.Equal(got, want) {
+			t.Errorf("got rows %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"fgo-script-parser/fgoscript"
+
+	_ "modernc.org/sqlite"
+)
+
+// Every result of a run is stored as a row in results, linked to its parent,
+// so runs can be reopened with the same tree and queried per script
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at   TEXT NOT NULL,
+	tool         TEXT NOT NULL,
+	tool_version TEXT NOT NULL,
+	region       TEXT NOT NULL,
+	source       TEXT NOT NULL,
+	id_type      TEXT NOT NULL,
+	inputs       TEXT NOT NULL,
+	collection   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS results (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_id     INTEGER NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+	parent_id  INTEGER REFERENCES results(id) ON DELETE CASCADE,
+	position   INTEGER NOT NULL,
+	kind       TEXT NOT NULL,
+	item_id    TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	source     TEXT NOT NULL,
+	lines      INTEGER NOT NULL,
+	characters INTEGER NOT NULL,
+	words      INTEGER NOT NULL,
+	arc        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS results_run ON results(run_id, parent_id, position);
+CREATE INDEX IF NOT EXISTS results_item ON results(kind, item_id);
+CREATE TABLE IF NOT EXISTS speakers (
+	result_id  INTEGER NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+	speaker    TEXT NOT NULL,
+	lines      INTEGER NOT NULL,
+	characters INTEGER NOT NULL,
+	words      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS speakers_result ON speakers(result_id);
+CREATE TABLE IF NOT EXISTS dialogue (
+	result_id INTEGER NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+	position  INTEGER NOT NULL,
+	speaker   TEXT NOT NULL,
+	text      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS dialogue_result ON dialogue(result_id, position);
+-- Only stored for the script or file that failed, parents get them from their children
+CREATE TABLE IF NOT EXISTS failed_scripts (
+	result_id INTEGER NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+	script_id TEXT NOT NULL,
+	error     TEXT NOT NULL
+);
+-- Stored for every result the duplicate was left out of, parents included
+CREATE TABLE IF NOT EXISTS duplicates (
+	result_id    INTEGER NOT NULL REFERENCES results(id) ON DELETE CASCADE,
+	position     INTEGER NOT NULL,
+	script_id    TEXT NOT NULL,
+	duplicate_of TEXT NOT NULL,
+	lines        INTEGER NOT NULL,
+	characters   INTEGER NOT NULL,
+	words        INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS duplicates_result ON duplicates(result_id, position);
+`
+
+// Store is a SQLite database of past runs and their results
+type Store struct {
+	db *sql.DB
+}
+
+// StoredRun is a run in the store, with the total of its results
+type StoredRun struct {
+	Id       int64
+	Metadata Metadata
+	// Number of top level results
+	Results    int
+	Total      fgoscript.Count
+	Incomplete bool
+}
+
+// defaultHistoryPath returns the path of the run history database in the user config directory
+func defaultHistoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "fgo-script-parser", "history.db")
+}
+
+// OpenStore opens the database at path, creating it and its directory if needed
+func OpenStore(path string) (*Store, error) {
+	if path == "" {
+		return nil, errors.New("no run history database is set")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("could not create run history directory. %s", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("could not open run history %s. %s", path, err)
+	}
+	if _, err := db.Exec(storeSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not set up run history %s. %s", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// SaveRun stores a run and its whole result tree, returning the ID of the run
+func (s *Store) SaveRun(ctx context.Context, metadata Metadata, results []fgoscript.ParseResult) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	inputs, err := json.Marshal(metadata.Inputs)
+	if err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO runs (created_at, tool, tool_version, region, source, id_type, inputs, collection) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		metadata.CreatedAt.UTC().Format(time.RFC3339Nano), metadata.Tool, metadata.Version, string(metadata.Region),
+		metadata.Source, metadata.IdType, string(inputs), metadata.Collection)
+	if err != nil {
+		return 0, fmt.Errorf("could not record run. %s", err)
+	}
+	runId, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := saveResults(ctx, tx, runId, nil, results); err != nil {
+		return 0, fmt.Errorf("could not record run results. %s", err)
+	}
+	return runId, tx.Commit()
+}
+
+func saveResults(ctx context.Context, tx *sql.Tx, runId int64, parentId *int64, results []fgoscript.ParseResult) error {
+	for i, r := range results {
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO results (run_id, parent_id, position, kind, item_id, name, source, lines, characters, words, arc) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			runId, parentId, i, string(r.Kind), r.Id, r.Name, r.Source, r.Count.Lines, r.Count.Characters, r.Count.Words, r.Arc)
+		if err != nil {
+			return err
+		}
+		resultId, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		for name, c := range r.Count.Speakers {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO speakers (result_id, speaker, lines, characters, words) VALUES (?, ?, ?, ?, ?)`,
+				resultId, name, c.Lines, c.Characters, c.Words)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, line := range r.Dialogue {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO dialogue (result_id, position, speaker, text) VALUES (?, ?, ?, ?)`,
+				resultId, i, line.Speaker, line.Text)
+			if err != nil {
+				return err
+			}
+		}
+
+		for i, d := range r.Duplicates {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO duplicates (result_id, position, script_id, duplicate_of, lines, characters, words) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				resultId, i, d.ScriptId, d.DuplicateOf, d.Count.Lines, d.Count.Characters, d.Count.Words)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(r.Children) > 0 {
+			if err := saveResults(ctx, tx, runId, &resultId, r.Children); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, f := range r.Failed {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO failed_scripts (result_id, script_id, error) VALUES (?, ?, ?)`,
+				resultId, f.ScriptId, f.Err.Error())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Runs returns every stored run, newest first
+func (s *Store) Runs(ctx context.Context) ([]StoredRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT r.id, r.created_at, r.tool, r.tool_version, r.region, r.source, r.id_type, r.inputs, r.collection,
+			COUNT(t.id), COALESCE(SUM(t.lines), 0), COALESCE(SUM(t.characters), 0), COALESCE(SUM(t.words), 0),
+			EXISTS (SELECT 1 FROM failed_scripts f JOIN results x ON x.id = f.result_id WHERE x.run_id = r.id)
+		FROM runs r
+		LEFT JOIN results t ON t.run_id = r.id AND t.parent_id IS NULL
+		GROUP BY r.id
+		ORDER BY r.id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("could not read run history. %s", err)
+	}
+	defer rows.Close()
+
+	var runs []StoredRun
+	for rows.Next() {
+		var run StoredRun
+		var createdAt, region, inputs string
+		err := rows.Scan(&run.Id, &createdAt, &run.Metadata.Tool, &run.Metadata.Version, &region,
+			&run.Metadata.Source, &run.Metadata.IdType, &inputs, &run.Metadata.Collection,
+			&run.Results, &run.Total.Lines, &run.Total.Characters, &run.Total.Words, &run.Incomplete)
+		if err != nil {
+			return nil, fmt.Errorf("could not read run history. %s", err)
+		}
+		if err := run.Metadata.scanStored(createdAt, region, inputs); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// LoadRun returns the metadata and result tree of a stored run
+func (s *Store) LoadRun(ctx context.Context, id int64) (Metadata, []fgoscript.ParseResult, error) {
+	var metadata Metadata
+	var createdAt, region, inputs string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT created_at, tool, tool_version, region, source, id_type, inputs, collection FROM runs WHERE id = ?`, id,
+	).Scan(&createdAt, &metadata.Tool, &metadata.Version, &region, &metadata.Source, &metadata.IdType, &inputs, &metadata.Collection)
+	if errors.Is(err, sql.ErrNoRows) {
+		return metadata, nil, fmt.Errorf("there is no run with ID %d", id)
+	} else if err != nil {
+		return metadata, nil, fmt.Errorf("could not read run %d. %s", id, err)
+	}
+	if err := metadata.scanStored(createdAt, region, inputs); err != nil {
+		return metadata, nil, err
+	}
+
+	type storedResult struct {
+		result   fgoscript.ParseResult
+		parentId sql.NullInt64
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, parent_id, kind, item_id, name, source, lines, characters, words, arc
+		FROM results WHERE run_id = ? ORDER BY id`, id)
+	if err != nil {
+		return metadata, nil, fmt.Errorf("could not read run %d. %s", id, err)
+	}
+	defer rows.Close()
+	byId := make(map[int64]*storedResult)
+	var order []int64
+	for rows.Next() {
+		var resultId int64
+		var r storedResult
+		var kind string
+		err := rows.Scan(&resultId, &r.parentId, &kind, &r.result.Id, &r.result.Name, &r.result.Source,
+			&r.result.Count.Lines, &r.result.Count.Characters, &r.result.Count.Words, &r.result.Arc)
+		if err != nil {
+			return metadata, nil, fmt.Errorf("could not read run %d. %s", id, err)
+		}
+		r.result.Kind = fgoscript.ResultKind(kind)
+		byId[resultId] = &r
+		order = append(order, resultId)
+	}
+	if err := rows.Err(); err != nil {
+		return metadata, nil, err
+	}
+
+	err = s.scanRows(ctx, `SELECT s.result_id, s.speaker, s.lines, s.characters, s.words FROM speakers s
+		JOIN results r ON r.id = s.result_id WHERE r.run_id = ?`, id, func(rows *sql.Rows) error {
+		var resultId int64
+		var name string
+		var c fgoscript.Count
+		if err := rows.Scan(&resultId, &name, &c.Lines, &c.Characters, &c.Words); err != nil {
+			return err
+		}
+		r := byId[resultId]
+		if r.result.Count.Speakers == nil {
+			r.result.Count.Speakers = make(map[string]fgoscript.Count)
+		}
+		r.result.Count.Speakers[name] = c
+		return nil
+	})
+	if err != nil {
+		return metadata, nil, fmt.Errorf("could not read run %d. %s", id, err)
+	}
+	err = s.scanRows(ctx, `SELECT d.result_id, d.speaker, d.text FROM dialogue d
+		JOIN results r ON r.id = d.result_id WHERE r.run_id = ? ORDER BY d.result_id, d.position`, id, func(rows *sql.Rows) error {
+		var resultId int64
+		var line fgoscript.DialogueLine
+		if err := rows.Scan(&resultId, &line.Speaker, &line.Text); err != nil {
+			return err
+		}
+		r := byId[resultId]
+		r.result.Dialogue = append(r.result.Dialogue, line)
+		return nil
+	})
+	if err != nil {
+		return metadata, nil, fmt.Errorf("could not read run %d. %s", id, err)
+	}
+	err = s.scanRows(ctx, `SELECT f.result_id, f.script_id, f.error FROM failed_scripts f
+		JOIN results r ON r.id = f.result_id WHERE r.run_id = ?`, id, func(rows *sql.Rows) error {
+		var resultId int64
+		var scriptId, message string
+		if err := rows.Scan(&resultId, &scriptId, &message); err != nil {
+			return err
+		}
+		r := byId[resultId]
+		r.result.Failed = append(r.result.Failed, &fgoscript.ScriptError{ScriptId: scriptId, Err: errors.New(message)})
+		return nil
+	})
+	if err != nil {
+		return metadata, nil, fmt.Errorf("could not read run %d. %s", id, err)
+	}
+	err = s.scanRows(ctx, `SELECT d.result_id, d.script_id, d.duplicate_of, d.lines, d.characters, d.words FROM duplicates d
+		JOIN results r ON r.id = d.result_id WHERE r.run_id = ? ORDER BY d.result_id, d.position`, id, func(rows *sql.Rows) error {
+		var resultId int64
+		var d fgoscript.Duplicate
+		if err := rows.Scan(&resultId, &d.ScriptId, &d.DuplicateOf, &d.Count.Lines, &d.Count.Characters, &d.Count.Words); err != nil {
+			return err
+		}
+		r := byId[resultId]
+		r.result.Duplicates = append(r.result.Duplicates, &d)
+		return nil
+	})
+	if err != nil {
+		return metadata, nil, fmt.Errorf("could not read run %d. %s", id, err)
+	}
+
+	// Build the tree bottom up, so every child is complete before it's copied into its parent.
+	// Children are always inserted after their parent, so going in reverse order works,
+	// but adds every result's children in reverse
+	var results []fgoscript.ParseResult
+	for _, resultId := range slices.Backward(order) {
+		r := byId[resultId]
+		slices.Reverse(r.result.Children)
+		if !r.parentId.Valid {
+			results = append(results, r.result)
+			continue
+		}
+		parent := byId[r.parentId.Int64]
+		parent.result.Children = append(parent.result.Children, r.result)
+		parent.result.Failed = append(parent.result.Failed, r.result.Failed...)
+	}
+	slices.Reverse(results)
+	sortFailed(results)
+	return metadata, results, nil
+}
+
+// DeleteRun removes a run and all of its results
+func (s *Store) DeleteRun(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM runs WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("could not delete run %d. %s", id, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("there is no run with ID %d", id)
+	}
+	return nil
+}
+
+// historyRow returns the columns describing a run in the history list
+func historyRow(run StoredRun) []string {
+	complete := "yes"
+	if run.Incomplete {
+		complete = "no"
+	}
+	idType := run.Metadata.IdType
+	if idType == "" {
+		idType = "files"
+	}
+	inputs := strings.Join(run.Metadata.Inputs, ", ")
+	if run.Metadata.Collection != "" {
+		inputs = run.Metadata.Collection
+	}
+	return []string{
+		strconv.FormatInt(run.Id, 10),
+		run.Metadata.CreatedAt.Local().Format("2006-01-02 15:04"),
+		run.Metadata.Source,
+		string(run.Metadata.Region),
+		idType,
+		inputs,
+		strconv.Itoa(run.Results),
+		strconv.Itoa(run.Total.Lines),
+		strconv.Itoa(run.Total.Characters),
+		complete,
+	}
+}
+
+// scanRows calls scan for every row returned by the query
+func (s *Store) scanRows(ctx context.Context, query string, id int64, scan func(*sql.Rows) error) error {
+	rows, err := s.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// sortFailed sorts the failed scripts gathered from children by script ID, like parsing does
+func sortFailed(results []fgoscript.ParseResult) {
+	for i := range results {
+		slices.SortFunc(results[i].Failed, func(a, b *fgoscript.ScriptError) int {
+			return strings.Compare(a.ScriptId, b.ScriptId)
+		})
+		sortFailed(results[i].Children)
+	}
+}
+
+// scanStored fills in the metadata columns stored as text
+func (m *Metadata) scanStored(createdAt, region, inputs string) error {
+	var err error
+	m.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return fmt.Errorf("could not read run history. %s", err)
+	}
+	m.Region = fgoscript.Region(region)
+	if err := json.Unmarshal([]byte(inputs), &m.Inputs); err != nil {
+		return fmt.Errorf("could not read run history. %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+)
+
+func TestStoreRoundTrip(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	metadata := newMetadata(fgoscript.RegionJP, atlas, fgoscript.IdTypeWar, []string{"100", "101"})
+	metadata.Collection = "Part 1 Singularities"
+	script := fgoscript.ParseResult{Id: "0100000010", Name: "0100000010", Kind: fgoscript.KindScript, Count: fgoscript.Count{Lines: 2, Characters: 5}}
+	war := fgoscript.ParseResult{Id: "100", Name: "Fuyuki", Kind: fgoscript.KindWar, Arc: "Part 1", Count: script.Count, Children: []fgoscript.ParseResult{script}}
+
+	id, err := store.SaveRun(ctx, metadata, []fgoscript.ParseResult{war})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, results, err := store.LoadRun(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Collection != metadata.Collection {
+		t.Errorf("got collection %q, want %q", loaded.Collection, metadata.Collection)
+	}
+	if len(results) != 1 || results[0].Arc != "Part 1" || len(results[0].Children) != 1 {
+		t.Fatalf("got results %+v, want the war with its arc and script", results)
+	}
+
+	runs, err := store.Runs(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Metadata.Collection != metadata.Collection {
+		t.Errorf("got runs %+v, want one run with the collection", runs)
+	}
+}
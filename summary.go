@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"slices"
+
+	"fgo-script-parser/fgoscript"
+)
+
+// Summary is the total of a set of results, and the mean and median count per result.
+// The mean and median are rounded to whole numbers, and their words are
+// always set, estimated from the characters if needed
+type Summary struct {
+	Results int             `json:"results"`
+	Total   fgoscript.Count `json:"total"`
+	Mean    fgoscript.Count `json:"mean"`
+	Median  fgoscript.Count `json:"median"`
+}
+
+// Summarize returns the summary of the results
+func Summarize(results []fgoscript.ParseResult) Summary {
+	summary := Summary{Results: len(results)}
+	if len(results) == 0 {
+		return summary
+	}
+
+	var lines, characters, words []int
+	for _, r := range results {
+		summary.Total = summary.Total.Add(r.Count)
+		lines = append(lines, r.Count.Lines)
+		characters = append(characters, r.Count.Characters)
+		words = append(words, r.Count.WordCount())
+	}
+	// Speakers aren't summarized
+	summary.Total.Speakers = nil
+
+	summary.Mean = fgoscript.Count{
+		Lines:      mean(lines),
+		Characters: mean(characters),
+		Words:      mean(words),
+	}
+	summary.Median = fgoscript.Count{
+		Lines:      median(lines),
+		Characters: median(characters),
+		Words:      median(words),
+	}
+	return summary
+}
+
+// Rows returns the labels and counts of the summary rows, in the order they are shown
+func (s Summary) Rows() []SummaryRow {
+	return []SummaryRow{
+		{Label: "Total", Count: s.Total},
+		{Label: "Mean", Count: s.Mean},
+		{Label: "Median", Count: s.Median},
+	}
+}
+
+// SummaryRow is a single labelled row of a summary
+type SummaryRow struct {
+	Label string
+	Count fgoscript.Count
+}
+
+func mean(values []int) int {
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	return int(math.Round(float64(sum) / float64(len(values))))
+}
+
+func median(values []int) int {
+	sorted := slices.Sorted(slices.Values(values))
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[middle]
+	}
+	return int(math.Round(float64(sorted[middle-1]+sorted[middle]) / 2))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+
+	"fgo-script-parser/fgoscript"
+)
+
+func TestSummarize(t *testing.T) {
+	count := func(lines, characters, words int) fgoscript.ParseResult {
+		return fgoscript.ParseResult{Count: fgoscript.Count{
+			Lines: lines, Characters: characters, Words: words,
+			Speakers: map[string]fgoscript.Count{"マシュ": {Lines: lines}},
+		}}
+	}
+	tests := []struct {
+		name    string
+		results []fgoscript.ParseResult
+		want    Summary
+	}{
+		{"empty", nil, Summary{}},
+		{
+			"odd",
+			[]fgoscript.ParseResult{count(1, 10, 0), count(2, 20, 0), count(10, 31, 0)},
+			Summary{
+				Results: 3,
+				Total:   fgoscript.Count{Lines: 13, Characters: 61},
+				// Words are estimated from the characters of each result
+				Mean:   fgoscript.Count{Lines: 4, Characters: 20, Words: 10},
+				Median: fgoscript.Count{Lines: 2, Characters: 20, Words: 10},
+			},
+		},
+		{
+			"even",
+			[]fgoscript.ParseResult{count(1, 10, 3), count(2, 11, 4), count(4, 20, 8), count(9, 30, 12)},
+			Summary{
+				Results: 4,
+				Total:   fgoscript.Count{Lines: 16, Characters: 71, Words: 27},
+				Mean:    fgoscript.Count{Lines: 4, Characters: 18, Words: 7},
+				// The middle two are averaged and rounded
+				Median: fgoscript.Count{Lines: 3, Characters: 16, Words: 6},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Summarize(tt.results)
+			if got.Results != tt.want.Results || !sameCount(got.Total, tt.want.Total) || !sameCount(got.Mean, tt.want.Mean) || !sameCount(got.Median, tt.want.Median) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+			if got.Total.Speakers != nil {
+				t.Errorf("got speakers %v in the total, want none", got.Total.Speakers)
+			}
+		})
+	}
+}
+
+func sameCount(a, b fgoscript.Count) bool {
+	return a.Lines == b.Lines && a.Characters == b.Characters && a.Words == b.Words
+}
+
+func TestSummaryRows(t *testing.T) {
+	rows := Summarize([]fgoscript.ParseResult{{Count: fgoscript.Count{Lines: 2}}}).Rows()
+	if len(rows) != 3 || rows[0].Label != "Total" || rows[1].Label != "Mean" || rows[2].Label != "Median" {
+		t.Errorf("got rows %+v, want the total, mean and median", rows)
+	}
+}
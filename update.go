@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 
+	"fgo-script-parser/fgoscript"
+
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/viewport"
@@ -14,6 +20,9 @@ import (
 
 type clearErrMsg struct{}
 
+// errMsg is an error that doesn't interrupt the current state
+type errMsg error
+
 func clearErrAfter(d time.Duration) tea.Cmd {
 	return tea.Tick(d, func(t time.Time) tea.Msg {
 		return clearErrMsg{}
@@ -36,76 +45,300 @@ func (m Model) copyToClipboard() tea.Msg {
 	return notificationMsg{message: "Row copied to clipboard!"}
 }
 
-func getTableColumns(totalWidth int, includeWordCount bool) []table.Column {
+func getTableColumns(totalWidth int, includeWordCount bool, sort Sort) []table.Column {
+	if includeWordCount {
+		return []table.Column{
+			{Title: "Id" + sort.indicator(SortId), Width: int((float64(totalWidth)) * 0.1)},
+			{Title: "Name" + sort.indicator(SortName), Width: int((float64(totalWidth)) * 0.4)},
+			{Title: "Lines" + sort.indicator(SortLines), Width: int((float64(totalWidth)) * 0.1)},
+			{Title: "Characters" + sort.indicator(SortCharacters), Width: int((float64(totalWidth)) * 0.15)},
+			{Title: "Words" + sort.indicator(SortWords), Width: int((float64(totalWidth)) * 0.25)},
+		}
+	} else {
+		return []table.Column{
+			{Title: "Id" + sort.indicator(SortId), Width: int((float64(totalWidth)) * 0.1)},
+			{Title: "Name" + sort.indicator(SortName), Width: int((float64(totalWidth)) * 0.5)},
+			{Title: "Lines" + sort.indicator(SortLines), Width: int((float64(totalWidth)) * 0.15)},
+			{Title: "Characters" + sort.indicator(SortCharacters), Width: int((float64(totalWidth)) * 0.25)},
+		}
+	}
+}
+
+func getSpeakerTableColumns(totalWidth int, includeWordCount bool) []table.Column {
 	if includeWordCount {
 		return []table.Column{
-			{Title: "Id", Width: int((float64(totalWidth)) * 0.1)},
-			{Title: "Name", Width: int((float64(totalWidth)) * 0.4)},
+			{Title: "Speaker", Width: int((float64(totalWidth)) * 0.5)},
 			{Title: "Lines", Width: int((float64(totalWidth)) * 0.1)},
 			{Title: "Characters", Width: int((float64(totalWidth)) * 0.15)},
 			{Title: "Words", Width: int((float64(totalWidth)) * 0.25)},
 		}
 	} else {
 		return []table.Column{
-			{Title: "Id", Width: int((float64(totalWidth)) * 0.1)},
-			{Title: "Name", Width: int((float64(totalWidth)) * 0.5)},
+			{Title: "Speaker", Width: int((float64(totalWidth)) * 0.6)},
 			{Title: "Lines", Width: int((float64(totalWidth)) * 0.15)},
 			{Title: "Characters", Width: int((float64(totalWidth)) * 0.25)},
 		}
 	}
 }
 
-func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
-	var cmd tea.Cmd
-	var cmds []tea.Cmd
+func getHistoryTableColumns(totalWidth int) []table.Column {
+	return []table.Column{
+		{Title: "Run", Width: int((float64(totalWidth)) * 0.06)},
+		{Title: "Date", Width: int((float64(totalWidth)) * 0.16)},
+		{Title: "Source", Width: int((float64(totalWidth)) * 0.12)},
+		{Title: "Region", Width: int((float64(totalWidth)) * 0.07)},
+		{Title: "Inputs", Width: int((float64(totalWidth)) * 0.3)},
+		{Title: "Lines", Width: int((float64(totalWidth)) * 0.1)},
+		{Title: "Characters", Width: int((float64(totalWidth)) * 0.12)},
+	}
+}
 
-	switch msg := msg.(type) {
-	case parseSuccessMsg:
-		_, w2 := calculateViewportWidths(m.terminalWidth)
-		var columns []table.Column
-		var rows []table.Row
+func getCompareTableColumns(totalWidth int, includeWordCount bool) []table.Column {
+	if includeWordCount {
+		return []table.Column{
+			{Title: "Change", Width: int((float64(totalWidth)) * 0.1)},
+			{Title: "Name", Width: int((float64(totalWidth)) * 0.45)},
+			{Title: "Lines", Width: int((float64(totalWidth)) * 0.1)},
+			{Title: "Characters", Width: int((float64(totalWidth)) * 0.15)},
+			{Title: "Words", Width: int((float64(totalWidth)) * 0.15)},
+		}
+	} else {
+		return []table.Column{
+			{Title: "Change", Width: int((float64(totalWidth)) * 0.1)},
+			{Title: "Name", Width: int((float64(totalWidth)) * 0.5)},
+			{Title: "Lines", Width: int((float64(totalWidth)) * 0.15)},
+			{Title: "Characters", Width: int((float64(totalWidth)) * 0.2)},
+		}
+	}
+}
 
-		columns = getTableColumns(w2, m.options.includeWordCount)
+// setCompare replaces the compared runs and rebuilds the compare table
+func (m *Model) setCompare(msg compareLoadedMsg) {
+	_, w2 := calculateViewportWidths(m.terminalWidth)
+	m.compareDiff = msg.diff
+	m.compareRuns = [2]int64{msg.oldId, msg.newId}
+	m.compareRows = flattenDiff(msg.diff.Changes)
+	var rows []table.Row
+	for _, row := range m.compareRows {
+		// Indent children under the items they are in
+		name := strings.Repeat("  ", row.Depth) + row.Name
+		if len(row.Dialogue) > 0 {
+			name += " (dialogue changed)"
+		}
+		delta := row.Delta()
+		cells := table.Row{string(row.Change), name, formatDelta(delta.Lines), formatDelta(delta.Characters)}
+		if m.compareWordCount() {
+			cells = append(cells, formatDelta(row.New.WordCount()-row.Old.WordCount()))
+		}
+		rows = append(rows, cells)
+	}
+	titleHeight := lipgloss.Height(m.compareTitleView())
+	m.compareTable = m.newTable(getCompareTableColumns(w2, m.compareWordCount()), rows, m.tableHeight()-titleHeight)
+}
 
-		if m.options.includeWordCount {
-			for _, r := range msg {
-				rows = append(rows, table.Row{r.id, r.name, fmt.Sprint(r.count.lines), fmt.Sprint(r.count.characters), fmt.Sprint(r.count.characters / 2)})
-			}
-		} else {
-			for _, r := range msg {
-				rows = append(rows, table.Row{r.id, r.name, fmt.Sprint(r.count.lines), fmt.Sprint(r.count.characters)})
-			}
+// setHistory replaces the recorded runs and rebuilds the history table
+func (m *Model) setHistory(runs []StoredRun) {
+	_, w2 := calculateViewportWidths(m.terminalWidth)
+	m.historyRuns = runs
+	var rows []table.Row
+	for _, run := range runs {
+		row := historyRow(run)
+		inputs := row[5]
+		if run.Incomplete {
+			inputs = "⚠ " + inputs
 		}
+		rows = append(rows, table.Row{row[0], row[1], row[2] + " " + row[4], row[3], inputs, row[7], row[8]})
+	}
+	titleHeight := lipgloss.Height(m.historyTitleView())
+	m.historyTable = m.newTable(getHistoryTableColumns(w2), rows, m.tableHeight()-titleHeight)
+}
 
-		headerHeight := lipgloss.Height(m.headerView())
-		footerHeight := lipgloss.Height(m.footerView())
-		verticalMarginHeight := headerHeight + footerHeight
-		styles := table.DefaultStyles()
-		styles.Header = styles.Header.Foreground(m.theme.TertiaryColor)
-		styles.Selected = styles.Selected.Foreground(m.theme.SecondaryColor)
+// setResults replaces the results and rebuilds the results table
+func (m *Model) setResults(results []fgoscript.ParseResult) {
+	m.results = results
+	m.resultPath = nil
+	m.refreshResultsTable()
+}
 
-		keys := table.KeyMap{
-			LineUp:   key.NewBinding(key.WithKeys("up")),
-			LineDown: key.NewBinding(key.WithKeys("down")),
+// refreshResultsTable rebuilds the results table in the current sort order
+func (m *Model) refreshResultsTable() {
+	_, w2 := calculateViewportWidths(m.terminalWidth)
+	m.shownResults = m.options.sort.Apply(m.levelResults())
+	match, err := newResultMatcher(m.filterInput.Value(), m.filterRegex)
+	// Keep showing every result until the regex is valid
+	m.filterErr = err
+	if err == nil {
+		m.shownResults = slices.DeleteFunc(m.shownResults, func(r fgoscript.ParseResult) bool { return !match(r) })
+	}
+	var rows []table.Row
+	for _, r := range m.shownResults {
+		name := r.Name
+		if r.Incomplete() {
+			name = "⚠ " + name
 		}
+		rows = append(rows, countRow(r.Count, m.showWordCount(), r.Id, name))
+	}
+
+	// The path of opened results is shown above the table, and the summary and filter below it
+	belowHeight := lipgloss.Height(m.summaryView())
+	if path := m.resultPathView(); path != "" {
+		belowHeight += lipgloss.Height(path)
+	}
+	if filter := m.filterView(); filter != "" {
+		belowHeight += lipgloss.Height(filter)
+	}
+	m.resultsTable = m.newTable(getTableColumns(w2, m.showWordCount(), m.options.sort), rows, m.tableHeight()-belowHeight)
+}
+
+// closeResult goes back up a level in the results table, selecting the result that was open
+func (m *Model) closeResult() {
+	closed := m.resultPath[len(m.resultPath)-1]
+	m.resultPath = m.resultPath[:len(m.resultPath)-1]
+	m.filterInput.Reset()
+	m.refreshResultsTable()
+	i := slices.IndexFunc(m.shownResults, func(r fgoscript.ParseResult) bool {
+		return r.Id == closed.Id && r.Name == closed.Name
+	})
+	m.resultsTable.SetCursor(max(i, 0))
+}
+
+// newTable creates a focused table filling the options pane
+func (m Model) newTable(columns []table.Column, rows []table.Row, height int) table.Model {
+	_, w2 := calculateViewportWidths(m.terminalWidth)
+	styles := table.DefaultStyles()
+	styles.Header = styles.Header.Foreground(m.theme.TertiaryColor)
+	styles.Selected = styles.Selected.Foreground(m.theme.SecondaryColor)
+
+	keys := table.KeyMap{
+		LineUp:   key.NewBinding(key.WithKeys("up")),
+		LineDown: key.NewBinding(key.WithKeys("down")),
+	}
+
+	return table.New(
+		table.WithColumns(columns),
+		table.WithRows(rows),
+		table.WithHeight(height),
+		table.WithWidth(w2),
+		table.WithStyles(styles),
+		table.WithFocused(true),
+		table.WithKeyMap(keys),
+	)
+}
+
+// tableHeight returns the height available for a table in the options pane
+func (m Model) tableHeight() int {
+	headerHeight := lipgloss.Height(m.headerView())
+	footerHeight := lipgloss.Height(m.footerView())
+	return m.terminalHeight - headerHeight - footerHeight
+}
 
-		t := table.New(
-			table.WithColumns(columns),
-			table.WithRows(rows),
-			table.WithHeight(m.terminalHeight-verticalMarginHeight),
-			table.WithWidth(w2),
-			table.WithStyles(styles),
-			table.WithFocused(true),
-			table.WithKeyMap(keys),
-		)
-		m.resultsTable = t
-		m.results = msg
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	var cmds []tea.Cmd
+
+	switch msg := msg.(type) {
+	case parseSuccessMsg:
+		if msg.id != m.parseId {
+			break
+		}
+		m.cancelParse()
+		m.setResults(msg.results)
+		m.runMetadata = msg.metadata
+		m.cacheStats = msg.cacheStats
 		m.currentState = Results
 		cmds = append(cmds, m.timer.Stop(), m.timer.Reset())
+		var notes []string
+		if msg.outputPath != "" {
+			notes = append(notes, "Results written to "+msg.outputPath)
+		}
+		if msg.runId != 0 {
+			notes = append(notes, fmt.Sprintf("Run recorded in history as %d", msg.runId))
+		}
+		if msg.duplicates > 0 {
+			notes = append(notes, fmt.Sprintf("%d duplicate scripts left out of the counts", msg.duplicates))
+		}
+		if len(notes) > 0 {
+			cmds = append(cmds, func() tea.Msg { return notificationMsg{message: strings.Join(notes, ". ")} })
+		}
+		var warning error
+		if msg.recordErr != nil {
+			warning = fmt.Errorf("Warning: the run was not recorded in history. %s", msg.recordErr)
+		}
+		if err := errors.Join(warning, msg.err); err != nil {
+			m.err = err
+			cmds = append(cmds, clearErrAfter(10*time.Second))
+		}
 	case parseFailureMsg:
-		m.err = msg
+		if msg.id != m.parseId {
+			break
+		}
+		m.cancelParse()
+		m.err = msg.err
 		m.currentState = Confirm
 		cmds = append(cmds, tea.WindowSize(), clearErrAfter(5*time.Second), m.timer.Stop(), m.timer.Reset())
+	case parseProgressMsg:
+		if msg.id != m.parseId {
+			break
+		}
+		m.progress = msg.progress
+		cmds = append(cmds, waitForProgress(m.parseId, m.progressCh))
+	case parseCancelledMsg:
+		if msg.id != m.parseId {
+			break
+		}
+		if m.options.keepPartial && len(msg.results) > 0 {
+			m.setResults(msg.results)
+			m.runMetadata = msg.metadata
+			cmds = append(cmds, func() tea.Msg {
+				return notificationMsg{message: fmt.Sprintf("Parsing cancelled, kept %d partial results", len(msg.results))}
+			})
+		} else {
+			cmds = append(cmds, func() tea.Msg { return notificationMsg{message: "Parsing cancelled"} })
+		}
+	case historyLoadedMsg:
+		if m.currentState != History {
+			m.historyReturn = m.currentState
+		}
+		m.setHistory(msg.runs)
+		m.currentState = History
+	case runLoadedMsg:
+		m.runMetadata = msg.metadata
+		// Match the options of the run, so it can be parsed again from the confirm step
+		m.options.region = msg.metadata.Region
+		m.selectedSource = atlas
+		if msg.metadata.Source == local.String() {
+			m.selectedSource = local
+		} else if idType, err := fgoscript.ParseAtlasIdType(msg.metadata.IdType); err == nil {
+			m.selectedAtlasIdType = idType
+		}
+		m.IdInput.SetValue(strings.Join(msg.metadata.Inputs, "\n"))
+		m.collection = nil
+		if collection, err := findCollection(m.config.collections, msg.metadata.Collection); msg.metadata.Collection != "" && err == nil {
+			m.collection = &collection
+		}
+		m.filterInput.Reset()
+		m.setResults(msg.results)
+		m.currentState = Results
+		cmds = append(cmds, func() tea.Msg { return notificationMsg{message: fmt.Sprintf("Opened run %d", msg.id)} })
+	case compareLoadedMsg:
+		m.compareBase = 0
+		m.setCompare(msg)
+		m.currentState = Compare
+	case runDeletedMsg:
+		cursor := m.historyTable.Cursor()
+		m.setHistory(slices.DeleteFunc(m.historyRuns, func(run StoredRun) bool { return run.Id == msg.id }))
+		m.historyTable.SetCursor(min(cursor, len(m.historyRuns)-1))
+		cmds = append(cmds, func() tea.Msg { return notificationMsg{message: fmt.Sprintf("Run %d deleted", msg.id)} })
+	case scriptLoadedMsg:
+		_, w2 := calculateViewportWidths(m.terminalWidth)
+		titleHeight := lipgloss.Height(m.scriptTitleView(msg.result))
+		m.viewedScript = msg.result
+		m.scriptViewer = viewport.New(w2-m.optionsPane.Style.GetHorizontalFrameSize(), m.tableHeight()-titleHeight)
+		m.scriptViewer.SetContent(m.renderAnnotatedScript(msg.lines))
+		m.currentState = ScriptViewer
+	case errMsg:
+		m.err = msg
+		cmds = append(cmds, tea.WindowSize(), clearErrAfter(5*time.Second))
 	case clearErrMsg:
 		m.err = nil
 		cmds = append(cmds, tea.WindowSize())
@@ -157,7 +390,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			case Confirm:
 				m.currentState = MiscOptions
 			case Results:
-				m.currentState = Confirm
+				if len(m.resultPath) > 0 {
+					m.closeResult()
+				} else {
+					m.currentState = Confirm
+				}
+			case Speakers, ScriptViewer:
+				m.currentState = Results
+			case History:
+				m.compareBase = 0
+				m.currentState = m.historyReturn
+			case Compare:
+				m.currentState = History
+			case CompareDialogue:
+				m.currentState = Compare
+			case CollectionSelect:
+				m.currentState = IdInput
+				if m.collection == nil {
+					m.IdInput.Focus()
+					m.IdInput.CursorEnd()
+				}
 			}
 
 		case key.Matches(msg, m.keymap.NextOption):
@@ -174,6 +426,8 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if int(m.currentOption) < OptionsMaxCount-1 {
 					m.currentOption = m.currentOption + 1
 				}
+			case CollectionSelect:
+				m.collectionCursor = min(m.collectionCursor+1, len(m.config.collections)-1)
 			}
 
 		case key.Matches(msg, m.keymap.PrevOption):
@@ -190,19 +444,61 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if int(m.currentOption) > 0 {
 					m.currentOption = m.currentOption - 1
 				}
+			case CollectionSelect:
+				m.collectionCursor = max(m.collectionCursor-1, 0)
 			}
 
 		case key.Matches(msg, m.keymap.Toggle):
 			switch m.currentOption {
 			case NoFile:
 				m.options.noFile = !m.options.noFile
+			case FileFormat:
+				m.options.format = OutputFormats[(int(m.options.format)+1)%len(OutputFormats)]
+			case OutputPath:
+				cmd = m.outputInput.Focus()
+				m.updateKeymap()
+				return m, cmd // Prevent the enter from being typed into the input
+			case IfExists:
+				i := slices.Index(ExistsPolicies, m.options.ifExists)
+				m.options.ifExists = ExistsPolicies[(i+1)%len(ExistsPolicies)]
 			case IncludeWordCount:
 				m.options.includeWordCount = !m.options.includeWordCount
+			case AtlasRegion:
+				i := slices.Index(fgoscript.Regions, m.options.region)
+				m.options.region = fgoscript.Regions[(i+1)%len(fgoscript.Regions)]
+			case WarNames:
+				i := slices.Index(fgoscript.NameStyles, m.options.names)
+				m.options.names = fgoscript.NameStyles[(i+1)%len(fgoscript.NameStyles)]
+			case Offline:
+				m.options.offline = !m.options.offline
+			case KeepPartial:
+				m.options.keepPartial = !m.options.keepPartial
+			case NoSummary:
+				m.options.noSummary = !m.options.noSummary
+			case KeepDuplicates:
+				m.options.keepDuplicates = !m.options.keepDuplicates
+			case Record:
+				m.options.record = !m.options.record
+			case ClearCache:
+				cmds = append(cmds, m.clearCacheCmd)
 			}
 
 		case key.Matches(msg, m.keymap.BlurInput):
 			m.IdInput.Blur()
 
+		case key.Matches(msg, m.keymap.PickCollection):
+			m.IdInput.Blur()
+			if m.collection != nil {
+				m.collectionCursor = max(slices.IndexFunc(m.config.collections, func(c Collection) bool { return c.Name == m.collection.Name }), 0)
+			}
+			m.currentState = CollectionSelect
+
+		case key.Matches(msg, m.keymap.SelectCollection):
+			collection := m.config.collections[m.collectionCursor]
+			m.collection = &collection
+			m.selectedAtlasIdType = fgoscript.IdTypeWar
+			m.currentState = IdInput
+
 		case key.Matches(msg, m.keymap.FocusInput):
 			m.IdInput.Focus()
 			m.IdInput.CursorEnd()
@@ -210,23 +506,118 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil // Prevent new line from double enter input
 
 		case key.Matches(msg, m.keymap.ClearInput):
+			if m.currentState == Results {
+				m.filterInput.Reset()
+				m.refreshResultsTable()
+				break
+			}
+			m.collection = nil
 			m.IdInput.Reset()
 			m.IdInput.Focus()
 			m.IdInput.CursorEnd()
 			m.updateKeymap()
 
+		case key.Matches(msg, m.keymap.Filter):
+			cmd = m.filterInput.Focus()
+			m.refreshResultsTable()
+			m.updateKeymap()
+			return m, cmd // Prevent the slash from being typed into the filter
+
+		case key.Matches(msg, m.keymap.FilterRegex):
+			m.filterRegex = !m.filterRegex
+			m.refreshResultsTable()
+
+		case key.Matches(msg, m.keymap.InputDone):
+			if m.currentState == MiscOptions {
+				m.outputInput.Blur()
+				break
+			}
+			m.filterInput.Blur()
+			m.refreshResultsTable()
+
+		case key.Matches(msg, m.keymap.ShowSpeakers):
+			result := m.shownResults[m.resultsTable.Cursor()]
+			_, w2 := calculateViewportWidths(m.terminalWidth)
+			var rows []table.Row
+			for _, s := range result.Count.SortedSpeakers() {
+				rows = append(rows, countRow(s.Count, m.showWordCount(), s.Name))
+			}
+
+			speakersTitleHeight := lipgloss.Height(m.speakersTitleView())
+			m.speakerTable = m.newTable(getSpeakerTableColumns(w2, m.showWordCount()), rows, m.tableHeight()-speakersTitleHeight)
+			m.currentState = Speakers
+
+		case key.Matches(msg, m.keymap.ViewScript):
+			if m.currentState == Compare {
+				row := m.compareRows[m.compareTable.Cursor()]
+				_, w2 := calculateViewportWidths(m.terminalWidth)
+				titleHeight := lipgloss.Height(m.compareDialogueTitleView(row))
+				m.scriptViewer = viewport.New(w2-m.optionsPane.Style.GetHorizontalFrameSize(), m.tableHeight()-titleHeight)
+				m.scriptViewer.SetContent(m.renderDialogueEdits(row.Dialogue))
+				m.currentState = CompareDialogue
+				break
+			}
+			cmds = append(cmds, m.loadScriptCmd(m.shownResults[m.resultsTable.Cursor()]))
+
+		case key.Matches(msg, m.keymap.OpenResult):
+			if m.currentState == History {
+				cmds = append(cmds, m.loadRunCmd(m.historyRuns[m.historyTable.Cursor()].Id))
+				break
+			}
+			m.resultPath = append(m.resultPath, m.shownResults[m.resultsTable.Cursor()])
+			m.filterInput.Reset()
+			m.refreshResultsTable()
+
+		case key.Matches(msg, m.keymap.Sort):
+			// Keys 1 to 5 match the column order of the table
+			column := SortColumn(int(msg.String()[0] - '0'))
+			if column == SortWords && !m.showWordCount() {
+				break
+			}
+			m.options.sort = m.options.sort.Next(column)
+			m.refreshResultsTable()
+
+		case key.Matches(msg, m.keymap.ShowHistory):
+			cmds = append(cmds, m.loadHistoryCmd)
+
+		case key.Matches(msg, m.keymap.CompareRun):
+			id := m.historyRuns[m.historyTable.Cursor()].Id
+			if m.compareBase == 0 || m.compareBase == id {
+				m.compareBase = id
+				break
+			}
+			cmds = append(cmds, m.compareRunsCmd(m.compareBase, id))
+
+		case key.Matches(msg, m.keymap.DeleteRun):
+			cmds = append(cmds, m.deleteRunCmd(m.historyRuns[m.historyTable.Cursor()].Id))
+
+		case key.Matches(msg, m.keymap.Export):
+			cmds = append(cmds, m.exportResultsCmd)
+
 		case key.Matches(msg, m.keymap.Copy):
 			cmds = append(cmds, m.copyToClipboard)
 
 		case key.Matches(msg, m.keymap.Confirm):
+			ctx, cancel := context.WithCancel(context.Background())
+			m.cancelParse = cancel
+			m.parseId++
+			m.progress = fgoscript.Progress{}
+			m.progressCh = make(chan fgoscript.Progress, 1)
 			m.currentState = Parsing
 			m.err = nil
 			return m, tea.Batch(
 				m.loadingSpinner.Tick,
 				m.timer.Start(),
-				m.parseScriptCmd(),
+				m.parseScriptCmd(ctx, m.parseId, m.progressCh),
+				waitForProgress(m.parseId, m.progressCh),
 			)
 
+		case key.Matches(msg, m.keymap.Cancel):
+			// In-flight requests stop right away, the cancelled message follows once they have
+			m.cancelParse()
+			m.currentState = Confirm
+			cmds = append(cmds, m.timer.Stop(), m.timer.Reset())
+
 		case key.Matches(msg, m.keymap.Quit):
 			m.quitting = true
 			m.abort = true
@@ -259,6 +650,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			m.IdInput.SetHeight(msg.Height - verticalMarginHeight - idInputDscriptionHeight)
 			m.IdInput.SetWidth(w2 - 5) // FIXME: Magic number
+			m.progressBar.Width = min(w2-5, 80)
 			m.IdInput.FocusedStyle.CursorLine = lipgloss.NewStyle().Foreground(m.theme.SecondaryColor)
 
 			m.loadingSpinner.Style = lipgloss.NewStyle().Foreground(m.theme.SecondaryColor)
@@ -274,8 +666,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 			m.IdInput.SetHeight(msg.Height - verticalMarginHeight - idInputDscriptionHeight)
 			m.IdInput.SetWidth(w2 - 5) // FIXME: Magic number
+			m.progressBar.Width = min(w2-5, 80)
 
-			m.resultsTable.SetColumns(getTableColumns(w2, m.options.includeWordCount))
+			m.resultsTable.SetColumns(getTableColumns(w2, m.showWordCount(), m.options.sort))
+			m.speakerTable.SetColumns(getSpeakerTableColumns(w2, m.showWordCount()))
+			m.historyTable.SetColumns(getHistoryTableColumns(w2))
+			m.compareTable.SetColumns(getCompareTableColumns(w2, m.compareWordCount()))
 		}
 	}
 
@@ -286,14 +682,37 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	cmds = append(cmds, cmd)
 	m.IdInput, cmd = m.IdInput.Update(msg)
 	cmds = append(cmds, cmd)
+	m.outputInput, cmd = m.outputInput.Update(msg)
+	cmds = append(cmds, cmd)
+	if m.filterInput.Focused() {
+		filter := m.filterInput.Value()
+		m.filterInput, cmd = m.filterInput.Update(msg)
+		cmds = append(cmds, cmd)
+		if m.filterInput.Value() != filter {
+			m.refreshResultsTable()
+		}
+	}
 	if m.currentState == Parsing {
 		m.loadingSpinner, cmd = m.loadingSpinner.Update(msg)
 		cmds = append(cmds, cmd)
 	}
 	m.timer, cmd = m.timer.Update(msg)
 	cmds = append(cmds, cmd)
-	m.resultsTable, cmd = m.resultsTable.Update(msg)
+	switch m.currentState {
+	case Speakers:
+		m.speakerTable, cmd = m.speakerTable.Update(msg)
+	case ScriptViewer, CompareDialogue:
+		m.scriptViewer, cmd = m.scriptViewer.Update(msg)
+	case History:
+		m.historyTable, cmd = m.historyTable.Update(msg)
+	case Compare:
+		m.compareTable, cmd = m.compareTable.Update(msg)
+	default:
+		m.resultsTable, cmd = m.resultsTable.Update(msg)
+	}
 	cmds = append(cmds, cmd)
+	// The selected row may have moved, which changes the keys it allows
+	m.updateKeymap()
 	m.help, cmd = m.help.Update(msg)
 	cmds = append(cmds, cmd)
 
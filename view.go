@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"strings"
+	"time"
+
+	"fgo-script-parser/fgoscript"
 
 	"github.com/charmbracelet/lipgloss"
 )
@@ -48,6 +51,7 @@ func (m Model) statePaneContent() string {
 		{state: MiscOptions, name: "Options"},
 		{state: Confirm, name: "Parse"},
 		{state: Results, name: "Results"},
+		{state: History, name: "History"},
 	}
 
 	var sb strings.Builder
@@ -58,8 +62,16 @@ func (m Model) statePaneContent() string {
 		if step.state == Results && len(m.results) == 0 {
 			continue
 		}
+		// The history is opened with a key rather than as a step
+		inHistory := m.currentState == History || m.currentState == Compare || m.currentState == CompareDialogue
+		if step.state == History && !inHistory {
+			continue
+		}
 
-		if step.state == m.currentState {
+		// The speaker breakdown and script viewer are part of the results step, comparing runs part of
+		// the history and the collection picker part of the IDs step
+		if step.state == m.currentState || (step.state == Results && (m.currentState == Speakers || m.currentState == ScriptViewer)) ||
+			(step.state == History && inHistory) || (step.state == IdInput && m.currentState == CollectionSelect) {
 			sb.WriteString(m.theme.renderSelected(selectedPrefix + truncateText(step.name, paneWidth)))
 		} else {
 			sb.WriteString(m.theme.renderInactiveState(prefix + truncateText(step.name, paneWidth)))
@@ -78,12 +90,25 @@ func (m Model) optionsPaneContent() string {
 		return m.atlasIdTypeSelectContent()
 	case IdInput:
 		return m.idInputContent()
+	case CollectionSelect:
+		return m.collectionSelectContent()
 	case MiscOptions:
 		return m.miscOptionsContent()
 	case Confirm, Parsing:
 		return m.parseContent()
 	case Results:
 		return m.resultsContent()
+	case Speakers:
+		return m.speakersContent()
+	case ScriptViewer:
+		return lipgloss.JoinVertical(lipgloss.Left, m.scriptTitleView(m.viewedScript), m.scriptViewer.View())
+	case History:
+		return m.historyContent()
+	case Compare:
+		return m.compareContent()
+	case CompareDialogue:
+		row := m.compareRows[m.compareTable.Cursor()]
+		return lipgloss.JoinVertical(lipgloss.Left, m.compareDialogueTitleView(row), m.scriptViewer.View())
 	}
 
 	return "Something went wrong..."
@@ -121,11 +146,11 @@ func (m Model) atlasIdTypeSelectContent() string {
 	options := []struct {
 		title       string
 		description string
-		atlasType   AtlasIdType
+		atlasType   fgoscript.AtlasIdType
 	}{
-		{title: "War", description: "Parse every script in a war (story chapter or event).\nEx: 100 for Fuyuki", atlasType: war},
-		{title: "Quest", description: "Parse every script in a quest (war section or interlude etc).\nEx: 1000001 for Fuyuki chapter 1", atlasType: quest},
-		{title: "Script", description: "Parse a list of specific scripts.\nEx: 0100000111 for Fuyuki chapter 1 post battle scene", atlasType: script},
+		{title: "War", description: "Parse every script in a war (story chapter or event).\nEx: 100 for Fuyuki", atlasType: fgoscript.IdTypeWar},
+		{title: "Quest", description: "Parse every script in a quest (war section or interlude etc).\nEx: 1000001 for Fuyuki chapter 1", atlasType: fgoscript.IdTypeQuest},
+		{title: "Script", description: "Parse a list of specific scripts.\nEx: 0100000111 for Fuyuki chapter 1 post battle scene", atlasType: fgoscript.IdTypeScript},
 	}
 
 	var sb strings.Builder
@@ -147,6 +172,16 @@ func (m Model) atlasIdTypeSelectContent() string {
 }
 
 func (m Model) idInputContent() string {
+	if m.collection != nil && m.selectedSource == atlas {
+		return lipgloss.JoinVertical(
+			lipgloss.Left,
+			lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render("IDs"),
+			m.theme.renderNormalText("Parsing a collection of wars instead of entered IDs.\nPress ctrl+x to clear it and enter IDs instead."),
+			"\n",
+			selectedPrefix+m.theme.renderSelected(m.collection.Name),
+			m.theme.renderDescription(strings.TrimSpace(m.collection.Description+"\n"+m.collection.summary())),
+		)
+	}
 	return lipgloss.JoinVertical(
 		lipgloss.Left,
 		m.idInputDescriptionView(),
@@ -154,14 +189,45 @@ func (m Model) idInputContent() string {
 	)
 }
 
+func (m Model) collectionSelectContent() string {
+	var sb strings.Builder
+	sb.WriteString(lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render("Collections"))
+	sb.WriteString("\n")
+	sb.WriteString(m.theme.renderNormalText("Predefined sets of wars to parse instead of entering war IDs.\nResults are given per member, and the total row is the total of the collection."))
+	sb.WriteString("\n\n")
+
+	for i, c := range m.config.collections {
+		description := strings.TrimSpace(c.Description + "\n" + c.summary())
+		if i == m.collectionCursor {
+			sb.WriteString(fmt.Sprintf(selectedPrefix+"%s\n%s\n", m.theme.renderSelected(c.Name), m.theme.renderDescription(description)))
+		} else {
+			sb.WriteString(fmt.Sprintf(prefix+"%s\n%s\n", m.theme.renderNormalText(c.Name), m.theme.renderDescription(description)))
+		}
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
 func (m Model) miscOptionsContent() string {
 	options := []struct {
 		title       string
 		description string
 		option      OptionsEnum
 	}{
-		{title: "No output file", description: "Print results only to the terminal.\n If unchecked, also outputs results to script-length.csv.", option: NoFile},
+		{title: "No output file", description: "Print results only to the terminal.\n If unchecked, also outputs results to the output path.", option: NoFile},
+		{title: fmt.Sprintf("Output format: %s", strings.ToUpper(m.options.format.String())), description: "Tab-separated list, JSON with the full result tree and run metadata, NDJSON with one record per line,\nor a Markdown or HTML report. Press enter to change.", option: FileFormat},
+		{title: "Output path: " + m.outputInput.View(), description: "Press enter to edit. Missing directories are created.\nPlaceholders: {source}, {type}, {region}, {ids}, {date}, {time}, {ext}", option: OutputPath},
+		{title: fmt.Sprintf("If the file exists: %s", m.options.ifExists), description: "Overwrite it, append to it (tsv and ndjson only), or write to a new file with a numbered suffix. Press enter to change.", option: IfExists},
 		{title: "Include word count", description: "Calculates the approximate English word count per result.\nEnglish word count is conventionally half the character count.", option: IncludeWordCount},
+		{title: fmt.Sprintf("Region: %s", m.options.region), description: "The game region to fetch scripts from and count for. Press enter to change.\nNA scripts are counted in words as well as characters.", option: AtlasRegion},
+		{title: fmt.Sprintf("War names: %s", m.options.names.Title()), description: "Names used for known wars, from Atlas or matched to local directories by name or ID.\nRaw uses the names from Atlas and the directory names as they are. Press enter to change.", option: WarNames},
+		{title: "Offline", description: "Only use cached Atlas responses.\nFails for any war, quest or script that hasn't been fetched before.", option: Offline},
+		{title: "Keep partial results", description: "Keep the results finished before parsing is cancelled.\nThey can be viewed in the results step, but aren't written to the output file.", option: KeepPartial},
+		{title: "No summary in output file", description: "Leave the total, mean and median rows out of the output file.\nThey are still shown below the results table.", option: NoSummary},
+		{title: "Keep duplicate scripts", description: "Count scripts with the same contents as a script counted before them.\nIf unchecked, they're left out of the counts and listed in the output file.", option: KeepDuplicates},
+		{title: "Record run in history", description: "Save the run and its results in the history database.\nPress h to browse recorded runs and reopen them.", option: Record},
+		{title: "Clear cache", description: fmt.Sprintf("Remove every cached Atlas response. Press enter to clear.\nLast run: %d cache hits, %d misses.", m.cacheStats.Hits, m.cacheStats.Misses), option: ClearCache},
 	}
 
 	var sb strings.Builder
@@ -181,6 +247,28 @@ func (m Model) miscOptionsContent() string {
 			if m.options.includeWordCount {
 				prefix = selectedCheckbox
 			}
+		case FileFormat, OutputPath, IfExists, AtlasRegion, WarNames, ClearCache:
+			prefix = selectedPrefix
+		case Offline:
+			if m.options.offline {
+				prefix = selectedCheckbox
+			}
+		case KeepPartial:
+			if m.options.keepPartial {
+				prefix = selectedCheckbox
+			}
+		case NoSummary:
+			if m.options.noSummary {
+				prefix = selectedCheckbox
+			}
+		case KeepDuplicates:
+			if m.options.keepDuplicates {
+				prefix = selectedCheckbox
+			}
+		case Record:
+			if m.options.record {
+				prefix = selectedCheckbox
+			}
 		}
 
 		if m.currentOption == o.option {
@@ -205,6 +293,8 @@ func (m Model) parseContent() string {
 				lipgloss.Left,
 				m.loadingSpinner.View()+" Parsing scripts...",
 				"Elapsed time: "+m.timer.View(),
+				"",
+				m.progressView(),
 			),
 		)
 
@@ -213,8 +303,228 @@ func (m Model) parseContent() string {
 	return sb.String()
 }
 
+// progressView shows how many items are done, the item being fetched and the estimated time left
+func (m Model) progressView() string {
+	p := m.progress
+	var sb strings.Builder
+	counts := []struct {
+		name  string
+		count fgoscript.ProgressCount
+	}{
+		{name: "Wars", count: p.Wars},
+		{name: "Quests", count: p.Quests},
+		{name: "Scripts", count: p.Scripts},
+	}
+	for _, c := range counts {
+		if c.count.Total == 0 {
+			continue
+		}
+		sb.WriteString(m.theme.renderNormalText(fmt.Sprintf("%-8s %d/%d", c.name, c.count.Done, c.count.Total)))
+		sb.WriteString("\n")
+	}
+	if p.Current != "" {
+		sb.WriteString(m.theme.renderDescription("Fetching " + p.Current))
+		sb.WriteString("\n")
+	}
+
+	percent := 0.0
+	if p.Scripts.Total > 0 {
+		percent = float64(p.Scripts.Done) / float64(p.Scripts.Total)
+	}
+	sb.WriteString("\n" + m.progressBar.ViewAs(percent) + "\n")
+
+	// Totals grow as wars are fetched, so this is only a rough estimate
+	elapsed := m.timer.Elapsed().Seconds()
+	if p.Scripts.Done > 0 && elapsed > 0 {
+		rate := float64(p.Scripts.Done) / elapsed
+		left := time.Duration(float64(p.Scripts.Total-p.Scripts.Done) / rate * float64(time.Second))
+		sb.WriteString(m.theme.renderDescription(fmt.Sprintf("%.1f scripts/s, about %s left", rate, left.Round(time.Second))))
+	}
+
+	return sb.String()
+}
+
 func (m Model) resultsContent() string {
-	return m.resultsTable.View()
+	var views []string
+	if path := m.resultPathView(); path != "" {
+		views = append(views, path)
+	}
+	views = append(views, m.resultsTable.View(), m.summaryView())
+	if filter := m.filterView(); filter != "" {
+		views = append(views, filter)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, views...)
+}
+
+// resultPathView shows the results opened from the results table. It is empty at the top level
+func (m Model) resultPathView() string {
+	if len(m.resultPath) == 0 {
+		return ""
+	}
+	var names []string
+	for _, r := range m.resultPath {
+		names = append(names, r.Name)
+	}
+	return lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render(strings.Join(names, " › ")) + "\n"
+}
+
+// summaryView shows the total, mean and median of the shown results, aligned with the table columns
+func (m Model) summaryView() string {
+	columns := m.resultsTable.Columns()
+	width := m.optionsPane.Width - m.optionsPane.Style.GetHorizontalFrameSize()
+	border := lipgloss.NewStyle().Foreground(m.theme.BorderColor).Render(strings.Repeat("─", max(0, width)))
+	labelStyle := lipgloss.NewStyle().Foreground(m.theme.TertiaryColor)
+
+	rows := []string{border}
+	for _, row := range Summarize(m.shownResults).Rows() {
+		cells := countRow(row.Count, m.showWordCount(), "", row.Label)
+		var rendered []string
+		for i, cell := range cells {
+			if i >= len(columns) {
+				break
+			}
+			// Matches the padding of the table cells
+			style := lipgloss.NewStyle().Width(columns[i].Width).MaxWidth(columns[i].Width).Inline(true)
+			cell = style.Render(cell)
+			if i == 1 {
+				cell = labelStyle.Render(cell)
+			}
+			rendered = append(rendered, lipgloss.NewStyle().Padding(0, 1).Render(cell))
+		}
+		row := lipgloss.JoinHorizontal(lipgloss.Top, rendered...)
+		rows = append(rows, lipgloss.NewStyle().MaxWidth(width).Render(row))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, rows...)
+}
+
+// filterView shows the results filter and the number of rows it matches.
+// It is empty when no filter is set
+func (m Model) filterView() string {
+	if !m.filterInput.Focused() && m.filterInput.Value() == "" {
+		return ""
+	}
+
+	mode := "substring"
+	if m.filterRegex {
+		mode = "regex"
+	}
+	status := m.theme.renderDescription(fmt.Sprintf("%d of %d results (%s)", len(m.shownResults), len(m.levelResults()), mode))
+	if m.filterErr != nil {
+		status = m.theme.renderError(m.filterErr.Error())
+	}
+	return "\n" + m.filterInput.View() + "\n" + status
+}
+
+func (m Model) speakersContent() string {
+	return lipgloss.JoinVertical(
+		lipgloss.Left,
+		m.speakersTitleView(),
+		m.speakerTable.View(),
+	)
+}
+
+func (m Model) speakersTitleView() string {
+	name := ""
+	if len(m.shownResults) > 0 {
+		name = m.shownResults[m.resultsTable.Cursor()].Name
+	}
+	return lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render("Speakers in "+name) + "\n"
+}
+
+func (m Model) historyContent() string {
+	if len(m.historyRuns) == 0 {
+		return lipgloss.JoinVertical(
+			lipgloss.Left,
+			m.historyTitleView(),
+			m.theme.renderNormalText("No runs have been recorded yet.\nCheck \"Record run in history\" in the options to record them."),
+		)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, m.historyTitleView(), m.historyTable.View())
+}
+
+func (m Model) historyTitleView() string {
+	description := "Runs recorded in " + m.config.History
+	if m.compareBase != 0 {
+		description = fmt.Sprintf("Comparing with run %d. Press c on another run to compare them", m.compareBase)
+	}
+	return lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render("History") + "\n" +
+		m.theme.renderDescription(description) + "\n"
+}
+
+func (m Model) compareContent() string {
+	if len(m.compareRows) == 0 {
+		return lipgloss.JoinVertical(lipgloss.Left, m.compareTitleView(), m.theme.renderNormalText("The runs have the same results."))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, m.compareTitleView(), m.compareTable.View())
+}
+
+func (m Model) compareTitleView() string {
+	title := fmt.Sprintf("Run %d → run %d", m.compareRuns[0], m.compareRuns[1])
+	// Only top level items, since their children add up to them
+	var lines, characters int
+	for _, d := range m.compareDiff.Changes {
+		lines += d.Delta().Lines
+		characters += d.Delta().Characters
+	}
+	summary := fmt.Sprintf("%d items changed, %s lines, %s characters", len(m.compareRows), formatDelta(lines), formatDelta(characters))
+	return lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render(title) + "\n" +
+		m.theme.renderDescription(summary) + "\n"
+}
+
+func (m Model) compareDialogueTitleView(row diffRow) string {
+	title := "Dialogue changes in " + strings.Join(row.Path, " › ")
+	return lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render(title) + "\n"
+}
+
+// renderDialogueEdits renders the dialogue lines added and removed in a script like a text diff
+func (m Model) renderDialogueEdits(edits []fgoscript.DialogueEdit) string {
+	styles := map[fgoscript.Change]lipgloss.Style{
+		fgoscript.Added:   lipgloss.NewStyle().Foreground(m.theme.SuccessColor),
+		fgoscript.Removed: lipgloss.NewStyle().Foreground(m.theme.ErrorColor),
+	}
+	var sb strings.Builder
+	for _, e := range edits {
+		sb.WriteString(styles[e.Change].Render(fmt.Sprintf("%s %s: %s", dialogueMarker(e.Change), e.Speaker, e.Text)))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func (m Model) scriptTitleView(result fgoscript.ParseResult) string {
+	title := fmt.Sprintf("Script %s: %d lines, %d characters", result.Name, result.Count.Lines, result.Count.Characters)
+	legend := lipgloss.NewStyle().Foreground(m.theme.SecondaryColor).Render("counted") + " " +
+		lipgloss.NewStyle().Foreground(m.theme.Gray).Faint(true).Render("[stripped]")
+	return lipgloss.NewStyle().Foreground(m.theme.TertiaryColor).Render(title) + "  " + legend + "\n"
+}
+
+// renderAnnotatedScript renders a script for the script viewer, with counted text highlighted,
+// stripped tags dimmed and the count of every dialogue line and choice next to where it starts
+func (m Model) renderAnnotatedScript(lines []fgoscript.AnnotatedLine) string {
+	styles := map[fgoscript.SpanKind]lipgloss.Style{
+		fgoscript.SpanPlain:   lipgloss.NewStyle().Foreground(m.theme.BodyColor),
+		fgoscript.SpanCounted: lipgloss.NewStyle().Foreground(m.theme.SecondaryColor).Bold(true),
+		fgoscript.SpanTag:     lipgloss.NewStyle().Foreground(m.theme.Gray).Faint(true),
+		fgoscript.SpanMarker:  lipgloss.NewStyle().Foreground(m.theme.TertiaryColor),
+	}
+	gutter := lipgloss.NewStyle().Foreground(m.theme.Gray)
+	annotation := lipgloss.NewStyle().Foreground(m.theme.Gold)
+
+	var sb strings.Builder
+	for _, l := range lines {
+		sb.WriteString(gutter.Render(fmt.Sprintf("%5d │ ", l.Number)))
+		for _, s := range l.Spans {
+			sb.WriteString(styles[s.Kind].Render(s.Text))
+		}
+		if l.Match != nil {
+			count := fmt.Sprintf("  ← %s: %d characters", l.Match.Speaker, l.Match.Characters)
+			if m.options.region.CountMode() == fgoscript.CountWords {
+				count += fmt.Sprintf(", %d words", l.Match.Words)
+			}
+			sb.WriteString(annotation.Render(count))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
 }
 
 func (m Model) headerView() string {
@@ -262,14 +572,15 @@ func (m Model) idInputDescriptionView() string {
 	switch m.selectedSource {
 	case atlas:
 		switch m.selectedAtlasIdType {
-		case war:
+		case fgoscript.IdTypeWar:
 			sb.WriteString("Enter the war IDs to parse from.")
-		case quest:
+		case fgoscript.IdTypeQuest:
 			sb.WriteString("Enter the quest IDs to parse from.")
-		case script:
+		case fgoscript.IdTypeScript:
 			sb.WriteString("Enter the script IDs to parse from.")
 		}
 		sb.WriteString("\nOnly one ID per line.")
+		sb.WriteString("\nPress ctrl+l to pick a collection of wars instead, such as the Lostbelts.")
 	case local:
 		sb.WriteString("Enter the filepaths to local files to parse from.")
 		sb.WriteString("\nFilepath can point to a directory or directly to a file (must include file extension).")